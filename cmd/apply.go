@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/knadh/koanf/providers/posflag"
+	"github.com/kubewarden/gostubpkg/pkg/gen"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Replace the stubbed modules with their stubs in the go.mod of a consumer module.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := k.Load(posflag.Provider(cmd.Flags(), ".", k), nil)
+		if err != nil {
+			logrus.Fatalf("error loading flags: %v", err)
+		}
+
+		logrus.SetLevel(logrus.Level(int(logrus.InfoLevel) + k.Int("verbose")))
+
+		consumer := k.String("consumer")
+		outputDir := k.String("output-dir")
+		revert := k.Bool("revert")
+		workFile := k.String("work-file")
+
+		switch {
+		case revert:
+			err = gen.RevertStubs(consumer)
+		case workFile != "":
+			err = gen.ApplyStubsWork(consumer, outputDir, workFile)
+		default:
+			err = gen.ApplyStubs(consumer, outputDir)
+		}
+		if err != nil {
+			cobra.CheckErr(err)
+		}
+	},
+}
+
+func init() {
+	var (
+		consumer  string
+		outputDir string
+		revert    bool
+		workFile  string
+	)
+
+	applyCmd.Flags().StringVarP(&consumer, "consumer", "C", ".", "Specify the directory of the consumer module")
+	applyCmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "Specify the output directory of the stubs (default $PWD)")
+	applyCmd.Flags().StringVarP(&workFile, "work-file", "w", "", "Specify a go.work file, created or updated, that replaces the stubbed modules\ninstead of editing the consumer go.mod")
+	applyCmd.Flags().BoolVarP(&revert, "revert", "r", false, "Remove the replace directives of the stubs and restore the ones they override")
+
+	rootCmd.AddCommand(applyCmd)
+}
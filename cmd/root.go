@@ -33,10 +33,40 @@ var rootCmd = &cobra.Command{
 		inputDir := k.String("input-dir")
 		outputDir := k.String("output-dir")
 		generateGoMod := k.Bool("generate-go-mod")
+		goVersion := k.String("go-version")
 		functionBodies := k.StringMap("function-bodies")
+		keepBodies := k.Strings("keep-bodies")
+		stubModules := k.Strings("stub-modules")
+		workFile := k.String("work-file")
 		allowImports := k.Strings("allow-imports")
+		keepGoing := k.Bool("keep-going")
+		layout := k.String("layout")
+		goos := k.String("goos")
+		goarch := k.String("goarch")
+		tags := k.Strings("tags")
+		env := k.Strings("env")
+		platforms := k.Strings("platform")
+		keepDocs := k.Bool("keep-docs")
+		stubNote := k.String("stub-note")
 
-		err = gen.GenerateStubs(inputDir, patterns, outputDir, generateGoMod, allowImports, functionBodies)
+		err = gen.GenerateStubs(inputDir, patterns, outputDir, gen.Options{
+			GenerateGoMod:  generateGoMod,
+			GoVersion:      goVersion,
+			AllowImports:   allowImports,
+			FunctionBodies: functionBodies,
+			KeepBodies:     keepBodies,
+			StubModules:    stubModules,
+			WorkFile:       workFile,
+			KeepGoing:      keepGoing,
+			Layout:         layout,
+			GOOS:           goos,
+			GOARCH:         goarch,
+			Tags:           tags,
+			Env:            env,
+			Platforms:      platforms,
+			KeepDocs:       keepDocs,
+			StubNote:       stubNote,
+		})
 		if err != nil {
 			cobra.CheckErr(err)
 		}
@@ -56,8 +86,21 @@ func init() {
 		inputDir       string
 		outputDir      string
 		generateGoMod  bool
+		goVersion      string
 		allowImports   []string
 		functionBodies map[string]string
+		keepBodies     []string
+		stubModules    []string
+		workFile       string
+		keepGoing      bool
+		layout         string
+		goos           string
+		goarch         string
+		tags           []string
+		env            []string
+		platforms      []string
+		keepDocs       bool
+		stubNote       string
 		verbose        int
 	)
 
@@ -69,7 +112,20 @@ func init() {
 	rootCmd.Flags().StringVarP(&inputDir, "input-dir", "i", "", "Specify the directory in which to run the build system's query tool that provides information about the packages (default $PWD)")
 	rootCmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "Specify the output directory for the stubs (default $PWD)")
 	rootCmd.Flags().BoolVarP(&generateGoMod, "generate-go-mod", "m", false, "Generate the go.mod file in the root of the stub package")
+	rootCmd.Flags().StringVar(&goVersion, "go-version", "", "Specify the go version of the generated go.mod files, the toolchain directive is dropped\n(default the version of the source module).\nExample: --go-version 1.22")
 	rootCmd.Flags().StringSliceVarP(&allowImports, "allow-imports", "a", nil, "Specify this flag multiple times to add external imports\nthat will not be removed from the generated stubs.\nExample: -a k8s.io/api/core/v1")
+	rootCmd.Flags().StringSliceVarP(&stubModules, "stub-modules", "s", nil, "Specify this flag multiple times to stub the packages of a module imported by the consumer module\nin the input directory, the patterns select the consumer packages.\nThe consumer go.mod is edited to replace the modules with the stubs.\nExample: -s k8s.io/client-go -s k8s.io/apimachinery")
+	rootCmd.Flags().StringVarP(&workFile, "work-file", "w", "", "Specify a go.work file, created or updated, that replaces the stubbed modules\ninstead of editing the consumer go.mod.\nExample: -w stubs.work")
+	rootCmd.Flags().BoolVarP(&keepGoing, "keep-going", "k", false, "Keep generating the stubs of the other packages when a package fails,\nall the errors are reported at the end")
+	rootCmd.Flags().BoolVarP(&keepDocs, "keep-docs", "d", false, "Keep the doc comments of the package and of the declarations, including the Deprecated notices")
+	rootCmd.Flags().StringVar(&stubNote, "stub-note", "", "Specify a line added to the doc comments of the stubbed functions.\nExample: --stub-note \"This function is a stub.\"")
+	rootCmd.Flags().StringVarP(&layout, "layout", "l", "", "Specify how the stubs of a package are split in files:\n\"package\" writes a single <pkg>.go file (default),\n\"file\" writes a stub file for every source file (default with --platform)")
+	rootCmd.Flags().StringVar(&goos, "goos", "", "Specify the target operating system of the loaded packages (default $GOOS)")
+	rootCmd.Flags().StringVar(&goarch, "goarch", "", "Specify the target architecture of the loaded packages (default $GOARCH)")
+	rootCmd.Flags().StringSliceVarP(&platforms, "platform", "p", nil, "Specify this flag multiple times to load the packages for several goos/goarch pairs,\nthe declarations that differ are guarded by build constraints.\nExample: -p linux/amd64 -p wasip1/wasm")
+	rootCmd.Flags().StringSliceVarP(&tags, "tags", "t", nil, "Specify this flag multiple times to add build tags used to load the packages.\nExample: -t integration -t netgo")
+	rootCmd.Flags().StringArrayVarP(&env, "env", "e", nil, "Specify this flag multiple times to set environment variables used to load the packages.\nExample: -e CGO_ENABLED=0")
+	rootCmd.Flags().StringArrayVarP(&keepBodies, "keep-bodies", "b", nil, "Specify this flag multiple times to keep the original body of a function,\nwith the same syntax of the function bodies.\nExample: -b \"yourpkg.IsNotFound\" -b \"yourpkg.(*YourType).YourMethod\"")
 	rootCmd.Flags().StringToStringVarP(&functionBodies, "function-bodies", "f", nil, "Specify this flag multiple times to add a type mapping.\nExample: -f \"cmd.Execute\"='println(\"hello world\")' -f \"yourpkg.(*YourType).YourMethod\"='return nil'")
 }
 
@@ -0,0 +1,368 @@
+package gen
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+)
+
+// replaceMarker marks the replace directives added to the go.mod of a consumer module.
+// It's followed by the replace directives they override, if any, like:
+//
+//	replace example.com/foo => ./stubs/example.com/foo // gostubpkg: replaces example.com/foo => ../foo
+const replaceMarker = "// gostubpkg"
+
+// ApplyStubs replaces the modules whose stubs are in stubsDir
+// with their stubs in the go.mod of the consumer module.
+// The replace directives already in the go.mod are restored by RevertStubs.
+func ApplyStubs(consumerDir string, stubsDir string) error {
+	stubs, err := consumerStubs(consumerDir, stubsDir)
+	if err != nil {
+		return err
+	}
+
+	return replaceModules(filepath.Join(consumerDir, "go.mod"), stubs)
+}
+
+// ApplyStubsWork is like ApplyStubs, but the replace directives are written in
+// the given go.work file, which uses the consumer module.
+// The go.work file is created if it doesn't exist, the consumer go.mod is not edited.
+func ApplyStubsWork(consumerDir string, stubsDir string, workPath string) error {
+	stubs, err := consumerStubs(consumerDir, stubsDir)
+	if err != nil {
+		return err
+	}
+
+	return replaceModulesWork(workPath, consumerDir, stubs)
+}
+
+// consumerStubs finds the stub modules in stubsDir that replace the
+// dependencies of the consumer module, it returns their directories by module path.
+func consumerStubs(consumerDir string, stubsDir string) (map[string]string, error) {
+	if stubsDir == "" {
+		stubsDir = "."
+	}
+
+	stubs, err := findStubs(stubsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stubs directory can contain the consumer module itself
+	content, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	delete(stubs, modfile.ModulePath(content))
+
+	if len(stubs) == 0 {
+		return nil, fmt.Errorf("no stub modules found in %s", stubsDir)
+	}
+
+	return stubs, nil
+}
+
+// RevertStubs removes the replace directives added by ApplyStubs
+// to the go.mod of the consumer module, and restores the ones they overrode.
+func RevertStubs(consumerDir string) error {
+	return editGoMod(filepath.Join(consumerDir, "go.mod"), revertReplaces)
+}
+
+// revertReplaces removes the replace directives added by gostubpkg
+// from the given go.mod, and restores the ones they overrode.
+func revertReplaces(goMod *modfile.File) error {
+	for _, r := range goMod.Replace {
+		if r.Syntax == nil {
+			continue
+		}
+
+		overridden, ok := markedReplaces(r.Syntax)
+		if !ok {
+			continue
+		}
+
+		log.Debugf("reverting the replace of %s", r.Old.Path)
+		err := goMod.DropReplace(r.Old.Path, r.Old.Version)
+		if err != nil {
+			return err
+		}
+
+		for _, o := range overridden {
+			err = goMod.AddReplace(o.Old.Path, o.Old.Version, o.New.Path, o.New.Version)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// findStubs finds the stub modules in the given directory,
+// it returns their directories by module path.
+// A stub module is written in the directory of its module path, like
+// <stubsDir>/k8s.io/api, the other modules, like the ones of the tools
+// or of the test data of a consumer, are skipped.
+func findStubs(stubsDir string) (map[string]string, error) {
+	stubs := make(map[string]string)
+	err := filepath.WalkDir(stubsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || d.Name() != "go.mod" {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		modulePath := modfile.ModulePath(content)
+		if modulePath == "" {
+			return fmt.Errorf("missing module path in %s", path)
+		}
+		if filepath.Dir(path) != filepath.Join(stubsDir, filepath.FromSlash(modulePath)) {
+			log.Debugf("skipping the module %s in %s", modulePath, filepath.Dir(path))
+			return nil
+		}
+		stubs[modulePath] = filepath.Dir(path)
+
+		return nil
+	})
+
+	return stubs, err
+}
+
+// replaceModules replaces the given modules with the stubs in their directories,
+// in the given go.mod file.
+func replaceModules(goModPath string, stubs map[string]string) error {
+	goModDir, err := filepath.Abs(filepath.Dir(goModPath))
+	if err != nil {
+		return err
+	}
+
+	modulePaths := []string{}
+	for modulePath := range stubs {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+
+	return editGoMod(goModPath, func(goMod *modfile.File) error {
+		for _, modulePath := range modulePaths {
+			stubDir, err := filepath.Abs(stubs[modulePath])
+			if err != nil {
+				return err
+			}
+
+			// the replaces overridden by a previous run are kept
+			overridden := []string{}
+			for _, r := range goMod.Replace {
+				if r.Old.Path != modulePath {
+					continue
+				}
+
+				if marked, ok := markedReplaces(r.Syntax); ok {
+					for _, m := range marked {
+						overridden = append(overridden, formatReplace(m))
+					}
+				} else {
+					overridden = append(overridden, formatReplace(r))
+				}
+			}
+
+			log.Debugf("replacing %s with %s", modulePath, stubDir)
+			err = goMod.AddReplace(modulePath, "", localPath(goModDir, stubDir), "")
+			if err != nil {
+				return err
+			}
+
+			marker := replaceMarker
+			if len(overridden) > 0 {
+				marker += ": replaces " + strings.Join(overridden, "; ")
+			}
+			for _, r := range goMod.Replace {
+				if r.Old.Path == modulePath {
+					r.Syntax.Comments.Suffix = []modfile.Comment{{Token: marker, Suffix: true}}
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// replaceModulesWork replaces the given modules with the stubs in their directories,
+// in the given go.work file. The go.work file uses the consumer module and
+// has the go version of its go.mod, if it's created.
+func replaceModulesWork(workPath string, consumerDir string, stubs map[string]string) error {
+	workDir, err := filepath.Abs(filepath.Dir(workPath))
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(workPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	work, err := modfile.ParseWork(workPath, content, nil)
+	if err != nil {
+		return err
+	}
+
+	consumerContent, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	if err != nil {
+		return err
+	}
+
+	consumer, err := modfile.Parse(filepath.Join(consumerDir, "go.mod"), consumerContent, nil)
+	if err != nil {
+		return err
+	}
+
+	if work.Go == nil && consumer.Go != nil {
+		err = work.AddGoStmt(consumer.Go.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	consumerAbs, err := filepath.Abs(consumerDir)
+	if err != nil {
+		return err
+	}
+
+	err = work.AddUse(localPath(workDir, consumerAbs), consumer.Module.Mod.Path)
+	if err != nil {
+		return err
+	}
+
+	modulePaths := []string{}
+	for modulePath := range stubs {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+
+	for _, modulePath := range modulePaths {
+		stubDir, err := filepath.Abs(stubs[modulePath])
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("replacing %s with %s", modulePath, stubDir)
+		err = work.AddReplace(modulePath, "", localPath(workDir, stubDir), "")
+		if err != nil {
+			return err
+		}
+	}
+
+	work.Cleanup()
+
+	log.Debugf("writing %s", workPath)
+	return os.WriteFile(workPath, modfile.Format(work.Syntax), 0o644)
+}
+
+// editGoMod applies the given edit to a go.mod file.
+func editGoMod(goModPath string, edit func(goMod *modfile.File) error) error {
+	content, err := os.ReadFile(goModPath)
+	if err != nil {
+		return err
+	}
+
+	goMod, err := modfile.Parse(goModPath, content, nil)
+	if err != nil {
+		return err
+	}
+
+	err = edit(goMod)
+	if err != nil {
+		return err
+	}
+
+	goMod.Cleanup()
+	content, err = goMod.Format()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("writing %s", goModPath)
+	return os.WriteFile(goModPath, content, 0o644)
+}
+
+// markedReplaces returns the replace directives overridden by a replace directive
+// added by gostubpkg. It returns false if the directive was not added by gostubpkg.
+func markedReplaces(line *modfile.Line) ([]*modfile.Replace, bool) {
+	for _, comment := range line.Comments.Suffix {
+		if comment.Token != replaceMarker && !strings.HasPrefix(comment.Token, replaceMarker+":") {
+			continue
+		}
+
+		replaces := []*modfile.Replace{}
+		overridden, _ := strings.CutPrefix(comment.Token, replaceMarker+": replaces ")
+		if overridden == comment.Token {
+			return replaces, true
+		}
+
+		for _, o := range strings.Split(overridden, "; ") {
+			r, ok := parseReplace(o)
+			if !ok {
+				log.Warnf("ignoring the invalid replace %q", o)
+				continue
+			}
+			replaces = append(replaces, r)
+		}
+
+		return replaces, true
+	}
+
+	return nil, false
+}
+
+// formatReplace formats a replace directive without the replace keyword.
+func formatReplace(r *modfile.Replace) string {
+	from := []string{modfile.AutoQuote(r.Old.Path)}
+	if r.Old.Version != "" {
+		from = append(from, r.Old.Version)
+	}
+
+	to := []string{modfile.AutoQuote(r.New.Path)}
+	if r.New.Version != "" {
+		to = append(to, r.New.Version)
+	}
+
+	return strings.Join(from, " ") + " => " + strings.Join(to, " ")
+}
+
+// parseReplace parses a replace directive formatted by formatReplace.
+func parseReplace(s string) (*modfile.Replace, bool) {
+	oldStr, newStr, ok := strings.Cut(s, " => ")
+	if !ok {
+		return nil, false
+	}
+
+	r := &modfile.Replace{}
+	from := strings.Fields(oldStr)
+	to := strings.Fields(newStr)
+	if len(from) == 0 || len(from) > 2 || len(to) == 0 || len(to) > 2 {
+		return nil, false
+	}
+
+	r.Old.Path = from[0]
+	if len(from) == 2 {
+		r.Old.Version = from[1]
+	}
+	r.New.Path = to[0]
+	if len(to) == 2 {
+		r.New.Version = to[1]
+	}
+
+	return r, true
+}
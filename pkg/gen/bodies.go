@@ -0,0 +1,254 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// keptBodies collects the declarations whose original source is copied in the stub.
+type keptBodies struct {
+	// funcs are the functions and the methods whose body is kept.
+	funcs map[*types.Func]bool
+	// vars are the package variables whose initializer is kept.
+	vars map[*types.Var]bool
+}
+
+// collectKeptBodies finds the functions listed in keepBodies, with the same keys
+// of the function bodies, and the declarations of the package their bodies need.
+// The functions and the variables of the package used by a kept body are kept
+// too, transitively, since their stubs would panic or be left uninitialized.
+func (s *stubber) collectKeptBodies(keepBodies []string) {
+	s.kept = keptBodies{
+		funcs: make(map[*types.Func]bool),
+		vars:  make(map[*types.Var]bool),
+	}
+	if len(keepBodies) == 0 {
+		return
+	}
+
+	// keptNode is a function declaration or a variable initializer
+	type keptNode struct {
+		symbol string
+		node   ast.Node
+	}
+
+	funcDecls := make(map[*types.Func]*ast.FuncDecl)
+	varSpecs := make(map[*types.Var]*ast.ValueSpec)
+	queue := []keptNode{}
+	for _, astFile := range s.pkg.Syntax {
+		if ast.IsGenerated(astFile) {
+			continue
+		}
+
+		for _, xdecl := range astFile.Decls {
+			switch decl := xdecl.(type) {
+			case *ast.FuncDecl:
+				fn, ok := s.info.Defs[decl.Name].(*types.Func)
+				if !ok || decl.Body == nil {
+					continue
+				}
+				funcDecls[fn] = decl
+
+				symbol, err := funcSymbol(decl)
+				if err != nil || !slices.Contains(keepBodies, s.pkg.Name+"."+symbol) {
+					continue
+				}
+				s.kept.funcs[fn] = true
+				queue = append(queue, keptNode{symbol, decl.Body})
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					valueSpec, ok := spec.(*ast.ValueSpec)
+					if !ok || len(valueSpec.Values) == 0 {
+						continue
+					}
+					for _, name := range valueSpec.Names {
+						if v, ok := s.info.Defs[name].(*types.Var); ok {
+							varSpecs[v] = valueSpec
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// a removed package is reported once for every declaration,
+	// the keys are the symbol and the package path
+	reported := make(map[[2]string]bool)
+	for len(queue) > 0 {
+		kn := queue[0]
+		queue = queue[1:]
+
+		ast.Inspect(kn.node, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			obj := s.info.Uses[ident]
+			if obj == nil || obj.Pkg() == nil {
+				return true
+			}
+
+			if obj.Pkg() != s.pkg.Types {
+				removed := [2]string{kn.symbol, obj.Pkg().Path()}
+				if !s.allowed(obj.Pkg().Path()) && !reported[removed] {
+					reported[removed] = true
+					s.errorf(ident.Pos(), kn.symbol, "cannot keep the body, %s of the removed package %s is used", obj.Name(), obj.Pkg().Path())
+				}
+				return true
+			}
+
+			switch obj := obj.(type) {
+			case *types.Func:
+				fn := obj.Origin()
+				if decl, ok := funcDecls[fn]; ok && !s.kept.funcs[fn] {
+					s.kept.funcs[fn] = true
+					// the receiver has already been checked
+					symbol, _ := funcSymbol(decl)
+					queue = append(queue, keptNode{symbol, decl.Body})
+				}
+			case *types.Var:
+				v := obj.Origin()
+				spec, ok := varSpecs[v]
+				if !ok || s.kept.vars[v] {
+					break
+				}
+
+				// a multi-value initializer, like var a, b = f(), is kept with all its variables
+				value := spec.Values[0]
+				for i, name := range spec.Names {
+					specVar, ok := s.info.Defs[name].(*types.Var)
+					if !ok || specVar != v && !isMultiValue(spec) {
+						continue
+					}
+					s.kept.vars[specVar] = true
+					if !isMultiValue(spec) {
+						value = spec.Values[i]
+					}
+				}
+				queue = append(queue, keptNode{v.Name(), value})
+			}
+
+			return true
+		})
+	}
+}
+
+// isMultiValue checks if the given spec declares its names with a single
+// multi-value initializer, like var a, b = f().
+func isMultiValue(spec *ast.ValueSpec) bool {
+	return len(spec.Names) > 1 && len(spec.Values) == 1
+}
+
+// isKeptVar checks if the given name declares a variable whose initializer is kept.
+func (s *stubber) isKeptVar(name *ast.Ident) bool {
+	v, ok := s.info.Defs[name].(*types.Var)
+	return ok && s.kept.vars[v]
+}
+
+// writeKeptValueSpec writes a variable spec with its original multi-value initializer.
+func (s *stubber) writeKeptValueSpec(buf *bytes.Buffer, decl *ast.GenDecl, spec *ast.ValueSpec) error {
+	names := []string{}
+	for _, name := range spec.Names {
+		names = append(names, name.Name)
+	}
+	log.Tracef("stubbing var %s", strings.Join(names, ", "))
+
+	v := s.formatDoc(specDoc(decl, spec.Doc), false) + "var " + strings.Join(names, ", ")
+	if spec.Type != nil {
+		v += " " + s.formatType(s.info.TypeOf(spec.Type))
+	}
+
+	src, err := s.formatSource(spec.Values[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteString(v + " = " + src + "\n\n")
+	return err
+}
+
+// formatSource returns the original source of the given node.
+// The references to the imported packages are rewritten with the names used
+// in the stub, this takes care of the renamed and the dot imports.
+func (s *stubber) formatSource(node ast.Node) (string, error) {
+	file := s.pkg.Fset.File(node.Pos())
+	src, err := s.source(file.Name())
+	if err != nil {
+		return "", err
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	edits := []edit{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ident, ok := n.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			pkgName, ok := s.info.Uses[ident].(*types.PkgName)
+			if !ok {
+				return true
+			}
+
+			if name := s.qualifier(pkgName.Imported()); name != ident.Name {
+				edits = append(edits, edit{file.Offset(ident.Pos()), file.Offset(ident.End()), name})
+			}
+			return false
+		case *ast.Ident:
+			// the package members are qualified, unless they are dot imported
+			obj := s.info.Uses[n]
+			if obj == nil || obj.Pkg() == nil || obj.Pkg() == s.pkg.Types || obj.Parent() != obj.Pkg().Scope() {
+				return true
+			}
+
+			offset := file.Offset(n.Pos())
+			edits = append(edits, edit{offset, offset, s.qualifier(obj.Pkg()) + "."})
+		}
+
+		return true
+	})
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+
+	str := ""
+	offset := file.Offset(node.Pos())
+	for _, e := range edits {
+		str += string(src[offset:e.start]) + e.text
+		offset = e.end
+	}
+	str += string(src[offset:file.Offset(node.End())])
+
+	return str, nil
+}
+
+// source returns the content of a source file of the package.
+func (s *stubber) source(filename string) ([]byte, error) {
+	if src, ok := s.sources[filename]; ok {
+		return src, nil
+	}
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the source: %w", err)
+	}
+	s.sources[filename] = src
+
+	return src, nil
+}
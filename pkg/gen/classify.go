@@ -0,0 +1,124 @@
+package gen
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// importKind is the category of an imported package.
+type importKind int
+
+const (
+	// importExternal is a package of a module that is not stubbed, it's removed from the stubs.
+	importExternal importKind = iota
+	// importStd is a package of the standard library.
+	importStd
+	// importSameModule is a package of one of the modules whose packages are stubbed.
+	importSameModule
+)
+
+// importClassifier classifies the imported packages by their module.
+type importClassifier struct {
+	// std are the import paths of the standard library.
+	std map[string]bool
+	// modules are the paths of the modules of the packages matching the patterns.
+	modules map[string]bool
+	// pkgModules maps the import paths of the loaded packages, and their dependencies, to their modules.
+	pkgModules map[string]*packages.Module
+}
+
+// newImportClassifier loads the packages matching the patterns, and their dependencies,
+// to classify their imports. It returns the import paths of the packages to stub:
+// the ones matching the patterns and the packages of the same modules they import, transitively.
+func newImportClassifier(inputDir string, patterns []string, opts Options) (*importClassifier, []string, error) {
+	std, err := loadStd(inputDir, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkgs, err := load(inputDir, patterns, opts, packages.NeedName|packages.NeedImports|packages.NeedDeps|packages.NeedModule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(pkgs) == 0 {
+		return nil, nil, fmt.Errorf("no packages found in %s", strings.Join(patterns, ", "))
+	}
+
+	c := &importClassifier{
+		std:        std,
+		modules:    make(map[string]bool),
+		pkgModules: make(map[string]*packages.Module),
+	}
+
+	pkgPaths := []string{}
+	for _, pkg := range pkgs {
+		pkgPaths = append(pkgPaths, pkg.PkgPath)
+		if pkg.Module != nil {
+			c.modules[pkg.Module.Path] = true
+		}
+	}
+
+	// the packages of the same modules are stubbed too, so the references to them are kept
+	packages.Visit(pkgs, func(pkg *packages.Package) bool {
+		c.pkgModules[pkg.PkgPath] = pkg.Module
+		if c.classify(pkg.PkgPath) != importSameModule {
+			return false
+		}
+
+		if !slices.Contains(pkgPaths, pkg.PkgPath) {
+			pkgPaths = append(pkgPaths, pkg.PkgPath)
+		}
+
+		return true
+	}, nil)
+
+	return c, pkgPaths, nil
+}
+
+// stdCache caches the import paths of the standard library by loadStdKey,
+// listing them is slower than loading the packages to stub.
+var stdCache sync.Map
+
+// loadStd returns the import paths of the standard library.
+func loadStd(inputDir string, opts Options) (map[string]bool, error) {
+	key := loadStdKey(inputDir, opts)
+	if std, ok := stdCache.Load(key); ok {
+		return std.(map[string]bool), nil
+	}
+
+	pkgs, err := load(inputDir, []string{"std"}, opts, packages.NeedName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the standard library: %w", err)
+	}
+
+	std := make(map[string]bool)
+	for _, pkg := range pkgs {
+		std[pkg.PkgPath] = true
+	}
+	stdCache.Store(key, std)
+
+	return std, nil
+}
+
+// loadStdKey returns the options that select the standard library packages.
+func loadStdKey(inputDir string, opts Options) string {
+	return strings.Join([]string{inputDir, opts.GOOS, opts.GOARCH, strings.Join(opts.Tags, ","), strings.Join(opts.Env, "\x00")}, "\x00")
+}
+
+// classify returns the category of the given import path.
+func (c *importClassifier) classify(importPath string) importKind {
+	if c.std[importPath] {
+		return importStd
+	}
+
+	if mod := c.pkgModules[importPath]; mod != nil && c.modules[mod.Path] {
+		return importSameModule
+	}
+
+	return importExternal
+}
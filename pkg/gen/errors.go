@@ -0,0 +1,78 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Error is returned when a declaration of a package cannot be stubbed.
+type Error struct {
+	// Package is the import path of the package.
+	Package string
+	// File and Line locate the declaration in the original source.
+	File string
+	Line int
+	// Symbol is the name of the declaration, like Foo or (*Foo).Bar.
+	// It's empty for errors that are not related to a declaration.
+	Symbol string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	s := e.Package
+	if e.File != "" {
+		s = fmt.Sprintf("%s:%d: %s", e.File, e.Line, s)
+	}
+	if e.Symbol != "" {
+		s += "." + e.Symbol
+	}
+
+	return s + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates the errors of all the packages that failed to be stubbed.
+type Errors []error
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+
+	if len(lines) == 1 {
+		return lines[0]
+	}
+
+	return fmt.Sprintf("%d errors occurred:\n\t%s", len(lines), strings.Join(lines, "\n\t"))
+}
+
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// newPackageError converts an error reported while loading a package.
+func newPackageError(pkg *packages.Package, pkgErr packages.Error) *Error {
+	err := &Error{
+		Package: pkg.PkgPath,
+		Err:     errors.New(pkgErr.Msg),
+	}
+
+	// the position is formatted as file:line:column
+	parts := strings.Split(pkgErr.Pos, ":")
+	if len(parts) >= 3 {
+		if line, convErr := strconv.Atoi(parts[len(parts)-2]); convErr == nil {
+			err.File = strings.Join(parts[:len(parts)-2], ":")
+			err.Line = line
+		}
+	}
+
+	return err
+}
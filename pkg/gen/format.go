@@ -3,147 +3,724 @@ package gen
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
+	"go/types"
+	"math/big"
 	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
-func formatType(typ interface{}, importedPackages []string) string {
+// erasedType replaces the types declared in packages removed from the stub.
+const erasedType = "interface{}"
+
+func (s *stubber) formatType(typ types.Type) string {
+	// types of removed packages are replaced by interface{},
+	// pointers to them too.
+	if s.isErased(typ) {
+		return erasedType
+	}
+
 	switch t := typ.(type) {
 	case nil:
 		return ""
-	case *ast.Ident:
-		return t.Name
-	case *ast.SelectorExpr:
-		// check if it is an allowed import
-		if slices.Contains(importedPackages, t.X.(*ast.Ident).Name) {
-			return fmt.Sprintf("%s.%s", formatType(t.X, importedPackages), t.Sel.Name)
-		} else {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.Invalid:
+			return erasedType
+		case types.UnsafePointer:
+			return s.qualifier(types.Unsafe) + ".Pointer"
+		default:
+			return t.Name()
+		}
+	case *types.Named:
+		return s.formatTypeName(t.Obj(), t.TypeArgs())
+	case *types.Alias:
+		return s.formatTypeName(t.Obj(), t.TypeArgs())
+	case *types.TypeParam:
+		return t.Obj().Name()
+	case *types.Pointer:
+		return fmt.Sprintf("*%s", s.formatType(t.Elem()))
+	case *types.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), s.formatType(t.Elem()))
+	case *types.Slice:
+		return fmt.Sprintf("[]%s", s.formatType(t.Elem()))
+	case *types.Map:
+		return fmt.Sprintf("map[%s]%s", s.formatType(t.Key()), s.formatType(t.Elem()))
+	case *types.Chan:
+		elem := s.formatType(t.Elem())
+		switch t.Dir() {
+		case types.SendOnly:
+			return fmt.Sprintf("chan<- %s", elem)
+		case types.RecvOnly:
+			return fmt.Sprintf("<-chan %s", elem)
+		default:
+			// chan (<-chan T) is not the same as chan<- (chan T)
+			if c, ok := t.Elem().(*types.Chan); ok && c.Dir() == types.RecvOnly {
+				return fmt.Sprintf("chan (%s)", elem)
+			}
+			return fmt.Sprintf("chan %s", elem)
+		}
+	case *types.Signature:
+		return fmt.Sprintf("func%s", s.formatSignature(t))
+	case *types.Union:
+		return s.formatUnion(t)
+	case *types.Interface:
+		// constraints written inline, like [T int] or [T ~string | ~[]byte]
+		if t.IsImplicit() && t.NumEmbeddeds() == 1 {
+			if str := s.formatType(t.EmbeddedType(0)); str != "" {
+				return str
+			}
+			// every term of the union has been removed
+			return "any"
+		}
+		if t.Empty() {
 			return "interface{}"
 		}
-	case *ast.StarExpr:
-		// do not add * to interface{}
-		ft := formatType(t.X, importedPackages)
-		if ft == "interface{}" {
-			return ft
-		}
-		return fmt.Sprintf("*%s", ft)
-	case *ast.ArrayType:
-		return fmt.Sprintf("[%s]%s", formatType(t.Len, importedPackages), formatType(t.Elt, importedPackages))
-	case *ast.Ellipsis:
-		return fmt.Sprintf("...%s", formatType(t.Elt, importedPackages))
-	case *ast.FuncType:
-		return fmt.Sprintf("func(%s)%s", formatFields(t.Params, importedPackages), formatFuncResults(t.Results, importedPackages))
-	case *ast.MapType:
-		return fmt.Sprintf("map[%s]%s", formatType(t.Key, importedPackages), formatType(t.Value, importedPackages))
-	case *ast.ChanType:
-		s := "chan"
-		if t.Arrow != token.NoPos {
-			if t.Begin == token.NoPos {
-				s = "<- chan"
+		return "interface {\n" + s.formatInterfaceElems(t) + "}"
+	case *types.Struct:
+		return "struct{" + s.formatStructFields(t) + "}"
+	default:
+		return erasedType
+	}
+}
+
+// formatTypeName formats a reference to a named type or an alias,
+// qualified by its package when it's not declared in the stubbed package.
+func (s *stubber) formatTypeName(obj *types.TypeName, typeArgs *types.TypeList) string {
+	name := obj.Name()
+	if obj.Pkg() != nil {
+		if q := s.qualifier(obj.Pkg()); q != "" {
+			name = q + "." + name
+		}
+	}
+
+	if typeArgs.Len() > 0 {
+		tparams := typeParams(obj)
+		name += "["
+		for i := range typeArgs.Len() {
+			if i > 0 {
+				name += ", "
+			}
+			if arg := typeArgs.At(i); s.isErased(arg) && tparams.Len() == typeArgs.Len() {
+				name += s.formatErasedTypeArg(arg, tparams.At(i))
 			} else {
-				s = "chan <-"
+				name += s.formatType(arg)
 			}
 		}
-		return fmt.Sprintf("%s %s", s, formatType(t.Value, importedPackages))
-	case *ast.BasicLit:
-		return t.Value
-	case *ast.InterfaceType:
-		return "interface {}"
-	case *ast.StructType:
-		return "struct{}"
+		name += "]"
+	}
+
+	return name
+}
+
+// formatErasedTypeArg formats a type argument whose type is removed from the stub.
+// It's replaced by interface{} when it satisfies the constraint of the type parameter,
+// otherwise by the constraint, if it only lists methods like fmt.Stringer,
+// or by the underlying type of the argument, if it satisfies the constraint like string for ~string.
+func (s *stubber) formatErasedTypeArg(arg types.Type, tparam *types.TypeParam) string {
+	constraint := tparam.Constraint()
+	iface, ok := constraint.Underlying().(*types.Interface)
+	switch {
+	// the constraints that refer to the type parameters cannot be written as type arguments
+	case !ok || types.Satisfies(types.NewInterfaceType(nil, nil), iface) || mentionsTypeParams(constraint):
+		return erasedType
+	case iface.IsMethodSet():
+		return s.formatType(constraint)
+	case types.Satisfies(arg.Underlying(), iface):
+		return s.formatType(arg.Underlying())
 	default:
-		return "interface{}"
+		return erasedType
 	}
 }
 
-func formatFields(fields *ast.FieldList, importedPackages []string) string {
-	s := ""
-	for i, field := range fields.List {
-		for j, name := range field.Names {
-			s += name.Name
-			if j != len(field.Names)-1 {
-				s += ","
+// typeParams returns the type parameters of a named type or of an alias.
+func typeParams(obj *types.TypeName) *types.TypeParamList {
+	switch t := obj.Type().(type) {
+	case *types.Named:
+		return t.TypeParams()
+	case *types.Alias:
+		return t.TypeParams()
+	default:
+		return nil
+	}
+}
+
+// mentionsTypeParams checks if the given type refers to a type parameter.
+func mentionsTypeParams(typ types.Type) bool {
+	switch t := typ.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Named:
+		return slices.ContainsFunc(slices.Collect(t.TypeArgs().Types()), mentionsTypeParams)
+	case *types.Alias:
+		return slices.ContainsFunc(slices.Collect(t.TypeArgs().Types()), mentionsTypeParams)
+	case *types.Pointer:
+		return mentionsTypeParams(t.Elem())
+	case *types.Slice:
+		return mentionsTypeParams(t.Elem())
+	case *types.Array:
+		return mentionsTypeParams(t.Elem())
+	case *types.Chan:
+		return mentionsTypeParams(t.Elem())
+	case *types.Map:
+		return mentionsTypeParams(t.Key()) || mentionsTypeParams(t.Elem())
+	case *types.Signature:
+		return mentionsTypeParams(t.Params()) || mentionsTypeParams(t.Results())
+	case *types.Tuple:
+		return slices.ContainsFunc(slices.Collect(t.Variables()), func(v *types.Var) bool { return mentionsTypeParams(v.Type()) })
+	case *types.Struct:
+		return slices.ContainsFunc(slices.Collect(t.Fields()), func(v *types.Var) bool { return mentionsTypeParams(v.Type()) })
+	case *types.Union:
+		return slices.ContainsFunc(slices.Collect(t.Terms()), func(term *types.Term) bool { return mentionsTypeParams(term.Type()) })
+	case *types.Interface:
+		return slices.ContainsFunc(slices.Collect(t.ExplicitMethods()), func(m *types.Func) bool { return mentionsTypeParams(m.Type()) }) ||
+			slices.ContainsFunc(slices.Collect(t.EmbeddedTypes()), mentionsTypeParams)
+	default:
+		return false
+	}
+}
+
+// formatSignature formats the parameters and the results of a function.
+func (s *stubber) formatSignature(sig *types.Signature) string {
+	return fmt.Sprintf("(%s)%s", s.formatTuple(sig.Params(), sig.Variadic()), s.formatFuncResults(sig.Results()))
+}
+
+func (s *stubber) formatTuple(tuple *types.Tuple, variadic bool) string {
+	str := ""
+	for i := range tuple.Len() {
+		v := tuple.At(i)
+		if v.Name() != "" {
+			str += v.Name() + " "
+		}
+
+		if variadic && i == tuple.Len()-1 {
+			str += "..." + s.formatType(v.Type().(*types.Slice).Elem())
+		} else {
+			str += s.formatType(v.Type())
+		}
+
+		if i != tuple.Len()-1 {
+			str += ", "
+		}
+	}
+
+	return str
+}
+
+// formatStructFields formats the fields of a struct, with their tags.
+func (s *stubber) formatStructFields(st *types.Struct) string {
+	str := ""
+	embedme := false
+	for i := range st.NumFields() {
+		field := st.Field(i)
+
+		switch {
+		case field.Embedded() && s.isErasedEmbedded(field.Type()):
+			// If the embedded type belongs to an external package
+			// we replace it with Embedme to make the code compilable.
+			// Embedme can be embedded only once, the other fields keep
+			// the name of the embedded type.
+			if !embedme {
+				str += "Embedme"
+				embedme = true
+			} else {
+				str += field.Name() + " " + erasedType
 			}
-			s += " "
+		case field.Embedded():
+			str += s.formatType(field.Type())
+		default:
+			str += field.Name() + " " + s.formatType(field.Type())
+		}
+
+		// The tags are kept even for the removed types,
+		// the stubs are serialized with the same keys.
+		if tag := st.Tag(i); tag != "" {
+			str += " " + formatTag(tag)
+		}
+
+		if i != st.NumFields()-1 {
+			str += "; "
 		}
-		s += formatType(field.Type, importedPackages)
-		if i != len(fields.List)-1 {
-			s += ", "
+	}
+
+	return str
+}
+
+// formatTag formats a struct tag as a raw string, when possible.
+func formatTag(tag string) string {
+	if strconv.CanBackquote(tag) {
+		return "`" + tag + "`"
+	}
+
+	return strconv.Quote(tag)
+}
+
+// formatUnion formats the terms of a type set, like ~int | ~float64.
+// The terms of removed packages are dropped, an empty string is returned
+// if none is left.
+func (s *stubber) formatUnion(u *types.Union) string {
+	terms := []string{}
+	for i := range u.Len() {
+		term := u.Term(i)
+		if s.isErased(term.Type()) {
+			log.Debugf("dropping union term %s", term)
+			continue
+		}
+
+		str := s.formatType(term.Type())
+		if term.Tilde() {
+			str = "~" + str
 		}
+		terms = append(terms, str)
 	}
 
-	return s
+	return strings.Join(terms, " | ")
 }
 
-// formatStructFields formats the fields of a struct.
-func formatStructFields(fields *ast.FieldList, importedPackages []string) string {
-	s := ""
-	for i, field := range fields.List {
-		for j, name := range field.Names {
-			s += name.Name
-			if j != len(field.Names)-1 {
-				s += ";"
+// formatInterfaceElems formats the embedded types and the methods of an interface,
+// one per line.
+// Embedded interfaces of removed packages are replaced by their method set,
+// so that the stub keeps the same methods.
+func (s *stubber) formatInterfaceElems(iface *types.Interface) string {
+	// The explicit methods are sorted by name, restore the source order
+	methods := make([]*types.Func, 0, iface.NumExplicitMethods())
+	for i := range iface.NumExplicitMethods() {
+		methods = append(methods, iface.ExplicitMethod(i))
+	}
+	sort.SliceStable(methods, func(i, j int) bool {
+		return methods[i].Pos() < methods[j].Pos()
+	})
+
+	// collect the methods that are not inlined first,
+	// a method can be declared only once
+	declared := make(map[string]struct{})
+	for _, m := range methods {
+		declared[m.Name()] = struct{}{}
+	}
+	for i := range iface.NumEmbeddeds() {
+		typ := iface.EmbeddedType(i)
+		if embedded, ok := typ.Underlying().(*types.Interface); ok && !s.isErased(typ) {
+			for j := range embedded.NumMethods() {
+				declared[embedded.Method(j).Name()] = struct{}{}
 			}
-			s += " "
 		}
-		ft := formatType(field.Type, importedPackages)
+	}
 
-		// quick and dirty, if formatType returns an interface{} it means
-		// that the field is an embedded struct of an external package
-		// We replace it with Embedme to make the code compilable.
-		if ft == "interface{}" && len(field.Names) == 0 {
-			s += "Embedme"
-		} else {
-			s += ft
+	str := ""
+	for i := range iface.NumEmbeddeds() {
+		typ := iface.EmbeddedType(i)
+		if !s.isErased(typ) {
+			// unions can be left without terms
+			if elem := s.formatType(typ); elem != "" {
+				str += elem + "\n"
+			}
+			continue
 		}
 
-		if i != len(fields.List)-1 {
-			s += "; "
+		embedded, ok := typ.Underlying().(*types.Interface)
+		if !ok {
+			log.Debugf("skipping embedded type %s", typ)
+			continue
+		}
+
+		log.Tracef("inlining the methods of the embedded interface %s", typ)
+		for j := range embedded.NumMethods() {
+			m := embedded.Method(j)
+			if _, ok := declared[m.Name()]; ok {
+				continue
+			}
+			declared[m.Name()] = struct{}{}
+			str += fmt.Sprintf("%s%s\n", m.Name(), s.formatSignature(m.Signature()))
 		}
 	}
 
-	return s
+	for _, m := range methods {
+		str += fmt.Sprintf("%s%s\n", m.Name(), s.formatSignature(m.Signature()))
+	}
+
+	return str
 }
 
-func formatFuncResults(fields *ast.FieldList, importedPackages []string) string {
-	s := ""
+func (s *stubber) formatFuncResults(results *types.Tuple) string {
+	str := ""
 
 	// Add brackets anyway. The formatter will remove them if not needed.
 	// This is helpful to simplify the code in case of named return values.
-	if fields != nil {
-		s = fmt.Sprintf("(%s)", formatFields(fields, importedPackages))
+	if results.Len() > 0 {
+		str = fmt.Sprintf("(%s)", s.formatTuple(results, false))
 	}
 
-	return s
+	return str
 }
 
-func formatFuncDecl(decl *ast.FuncDecl, importedPackages []string) string {
-	s := "func "
+// formatTypeParams formats a type parameter list, like [K comparable, V any].
+func (s *stubber) formatTypeParams(tparams *types.TypeParamList) string {
+	if tparams.Len() == 0 {
+		return ""
+	}
+
+	str := "["
+	for i := range tparams.Len() {
+		tparam := tparams.At(i)
+		str += tparam.Obj().Name()
+
+		// [K, V any] shares the same constraint
+		if i != tparams.Len()-1 && tparams.At(i+1).Constraint() == tparam.Constraint() {
+			str += ", "
+			continue
+		}
 
-	if decl.Recv != nil {
-		if len(decl.Recv.List) != 1 {
-			panic(fmt.Errorf("strange receiver for %s: %#v", decl.Name.Name, decl.Recv))
+		constraint := s.formatType(tparam.Constraint())
+		str += " " + constraint
+		if i != tparams.Len()-1 {
+			str += ", "
 		}
 
-		field := decl.Recv.List[0]
-		if len(field.Names) != 1 {
-			panic(fmt.Errorf("strange receiver field for %s: %#v", decl.Name.Name, field))
+		// type Ptr[T *int] would be parsed as an array type,
+		// the trailing comma makes it a type parameter list
+		if tparams.Len() == 1 && (strings.HasPrefix(constraint, "*") || strings.HasPrefix(constraint, "(")) {
+			str += ","
 		}
-		s += fmt.Sprintf("(%s %s) ", field.Names[0], formatType(field.Type, importedPackages))
 	}
+	str += "]"
+
+	return str
+}
+
+func (s *stubber) formatFuncDecl(decl *ast.FuncDecl) (string, error) {
+	str := "func "
+
+	fn, ok := s.info.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return "", fmt.Errorf("missing type information for function")
+	}
+	sig := fn.Signature()
+
+	if recv := sig.Recv(); recv != nil {
+		// the receiver can be unnamed, like func (*T) Foo()
+		str += "(" + strings.TrimSpace(recv.Name()+" "+s.formatType(recv.Type())) + ") "
+	}
+
+	str += decl.Name.Name + s.formatTypeParams(sig.TypeParams()) + s.formatSignature(sig)
 
-	// generics
-	g := ""
-	if decl.Type.TypeParams != nil {
-		g += "["
-		for _, v := range decl.Type.TypeParams.List {
-			g += fmt.Sprintf("%s %s,", v.Names[0].Name, formatType(v.Type, importedPackages))
+	return str, nil
+}
+
+// formatConst formats the type and the value of a constant, like " Phase = 1".
+// The type is omitted for untyped constants.
+func (s *stubber) formatConst(c *types.Const) string {
+	str := ""
+
+	switch t := c.Type().(type) {
+	case *types.Basic:
+		if t.Info()&types.IsUntyped != 0 {
+			// keep the kind of untyped runes, 'a' is not the same as 97
+			if t.Kind() == types.UntypedRune {
+				if r, ok := constant.Int64Val(c.Val()); ok {
+					return " = " + strconv.QuoteRune(rune(r))
+				}
+			}
+			break
+		}
+		str += " " + s.formatType(t)
+	default:
+		// The underlying type of a constant is always a basic type,
+		// use it when the named type is removed from the stub.
+		// The aliases are resolved, since they are kept even if their type is removed.
+		if s.isErasedConstType(types.Unalias(t)) {
+			str += " " + s.formatType(t.Underlying())
+		} else {
+			str += " " + s.formatType(t)
 		}
-		g += "]"
 	}
 
-	s += fmt.Sprintf("%s%s(%s)", decl.Name.Name, g, formatFields(decl.Type.Params, importedPackages))
-	s += formatFuncResults(decl.Type.Results, importedPackages)
+	return str + " = " + formatConstValue(c.Val())
+}
+
+// formatConstValue formats the exact value of a constant as a Go expression.
+func formatConstValue(val constant.Value) string {
+	switch val.Kind() {
+	case constant.Float:
+		// Prefer the short form, unless it's an approximation.
+		str := val.String()
+		if !isExactFloatLiteral(str, val) {
+			str = formatExactFloat(val)
+		}
+		// an integer literal would change the kind of untyped constants
+		if !strings.ContainsAny(str, ".eEpP") {
+			str += ".0"
+		}
+		return str
+	case constant.Complex:
+		return fmt.Sprintf("complex(%s, %s)", formatConstValue(constant.Real(val)), formatConstValue(constant.Imag(val)))
+	default:
+		return val.ExactString()
+	}
+}
+
+// formatExactFloat formats the exact value of a float constant. The values with
+// a finite decimal expansion, like math.Pi or float32(0.1), are written in full,
+// the others are written as a float division, like 1.0/3.
+func formatExactFloat(val constant.Value) string {
+	num := bigInt(constant.Num(val))
+	den := bigInt(constant.Denom(val))
+
+	// the expansion is finite if the denominator has only the factors 2 and 5
+	rest := new(big.Int).Set(den)
+	digits := 0
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		n := 0
+		for new(big.Int).Mod(rest, f).Sign() == 0 {
+			rest.Quo(rest, f)
+			n++
+		}
+		digits = max(digits, n)
+	}
+	if rest.Cmp(big.NewInt(1)) != 0 {
+		return num.String() + ".0/" + den.String()
+	}
+	if digits == 0 {
+		return num.String()
+	}
+
+	// num/den = num*10^digits/den / 10^digits, where the division is exact
+	scaled := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	scaled.Mul(scaled, new(big.Int).Abs(num))
+	scaled.Quo(scaled, den)
+
+	str := scaled.String()
+	if len(str) <= digits {
+		str = strings.Repeat("0", digits-len(str)+1) + str
+	}
+	str = str[:len(str)-digits] + "." + str[len(str)-digits:]
+	if num.Sign() < 0 {
+		str = "-" + str
+	}
+
+	return str
+}
+
+// bigInt returns the value of an integer constant.
+func bigInt(val constant.Value) *big.Int {
+	switch v := constant.Val(val).(type) {
+	case int64:
+		return big.NewInt(v)
+	case *big.Int:
+		return v
+	default:
+		return new(big.Int)
+	}
+}
+
+// isExactFloatLiteral checks if the given literal represents exactly the given value.
+func isExactFloatLiteral(lit string, val constant.Value) bool {
+	neg := strings.HasPrefix(lit, "-")
+	litVal := constant.MakeFromLiteral(strings.TrimPrefix(lit, "-"), token.FLOAT, 0)
+	if litVal.Kind() == constant.Unknown {
+		return false
+	}
+	if neg {
+		litVal = constant.UnaryOp(token.SUB, litVal, 0)
+	}
+
+	return constant.Compare(litVal, token.EQL, val)
+}
+
+// formatVar formats the type and the initial value of a variable, like " *Client".
+// Only basic literals and sentinel errors are kept as initial values,
+// the other variables are declared with the zero value of their type.
+func (s *stubber) formatVar(v *types.Var, explicitType bool, value ast.Expr) string {
+	typ := " " + s.formatType(v.Type())
+
+	str := ""
+	if explicitType {
+		str = typ
+	}
+
+	switch value := value.(type) {
+	case *ast.BasicLit:
+		return str + " = " + value.Value
+	case *ast.CallExpr:
+		if err := s.formatSentinelError(value); err != "" {
+			return str + " = " + err
+		}
+	}
+
+	return typ
+}
+
+// formatSentinelError formats an error created by errors.New or fmt.Errorf,
+// so that the stub keeps a distinct error value that can be used with errors.Is.
+// It returns an empty string when the call is not a sentinel error.
+func (s *stubber) formatSentinelError(call *ast.CallExpr) string {
+	fn, ok := typeutil.Callee(s.info, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || len(call.Args) == 0 {
+		return ""
+	}
+
+	msg := s.info.Types[call.Args[0]].Value
+	if msg == nil || msg.Kind() != constant.String {
+		return ""
+	}
+
+	switch fn.Pkg().Path() + "." + fn.Name() {
+	case "errors.New":
+		return fmt.Sprintf("%s.New(%s)", s.qualifier(fn.Pkg()), msg.ExactString())
+	case "fmt.Errorf":
+		// Keep the arguments that are constants or package variables of the
+		// stubbed package and of the kept packages, like os.ErrNotExist.
+		// errors.New is used otherwise, without the formatting verbs.
+		args := []string{msg.ExactString()}
+		for _, arg := range call.Args[1:] {
+			kept := s.formatErrorfArg(arg)
+			if kept == "" {
+				msg := constant.MakeString(stripVerbs(constant.StringVal(msg)))
+				return fmt.Sprintf("%s.New(%s)", s.qualifier(types.NewPackage("errors", "errors")), msg.ExactString())
+			}
+			args = append(args, kept)
+		}
+		return fmt.Sprintf("%s.Errorf(%s)", s.qualifier(fn.Pkg()), strings.Join(args, ", "))
+	default:
+		return ""
+	}
+}
+
+// formatErrorfArg formats an argument of fmt.Errorf kept in the stub.
+// It returns an empty string when the argument cannot be kept.
+func (s *stubber) formatErrorfArg(arg ast.Expr) string {
+	// the named types are left out, they could format the value with a String method
+	if tv := s.info.Types[arg]; tv.Value != nil {
+		if _, ok := tv.Type.(*types.Basic); ok {
+			return formatConstValue(tv.Value)
+		}
+		return ""
+	}
+
+	var ident *ast.Ident
+	switch arg := arg.(type) {
+	case *ast.Ident:
+		ident = arg
+	case *ast.SelectorExpr:
+		ident = arg.Sel
+	default:
+		return ""
+	}
+
+	v, ok := s.info.Uses[ident].(*types.Var)
+	if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+		return ""
+	}
+
+	if v.Pkg() == s.pkg.Types {
+		return v.Name()
+	}
+	if !s.allowed(v.Pkg().Path()) {
+		return ""
+	}
+
+	return s.qualifier(v.Pkg()) + "." + v.Name()
+}
+
+// stripVerbs removes the formatting verbs from a format string, like "invalid: %w".
+func stripVerbs(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		// skip the flags, the width and the precision up to the verb
+		j := i + 1
+		for j < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[j]) >= 0 {
+			j++
+		}
+		if j < len(format) && format[j] == '%' {
+			b.WriteByte('%')
+		}
+		// don't leave a double space in place of the verb
+		if j+1 < len(format) && format[j+1] == ' ' && strings.HasSuffix(b.String(), " ") {
+			j++
+		}
+		i = j
+	}
+
+	return strings.TrimRight(b.String(), " :")
+}
+
+// isPackageVar checks if the given object is a variable declared at the top level of the stubbed package.
+func (s *stubber) isPackageVar(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	return ok && v.Pkg() == s.pkg.Types && v.Parent() == s.pkg.Types.Scope()
+}
+
+// formatDoc formats a doc comment, if the doc comments are kept.
+// The directives, like //go:embed, are dropped: they apply to the source declarations.
+// The stub note is added when requested, even if the declaration has no doc comment.
+func (s *stubber) formatDoc(doc *ast.CommentGroup, note bool) string {
+	lines := []string{}
+	if s.keepDocs && doc != nil {
+		for _, comment := range doc.List {
+			if !isDirective(comment.Text) {
+				lines = append(lines, comment.Text)
+			}
+		}
+	}
+
+	// the blank lines that separated the directives are dropped too
+	for len(lines) > 0 && lines[len(lines)-1] == "//" {
+		lines = lines[:len(lines)-1]
+	}
+
+	str := ""
+	for _, line := range lines {
+		str += line + "\n"
+	}
+
+	if note && s.stubNote != "" {
+		// the note is a paragraph on its own
+		if str != "" {
+			str += "//\n"
+		}
+		str += "// " + s.stubNote + "\n"
+	}
+
+	return str
+}
+
+// isDirective checks if the given comment is a directive, like //go:generate or //line,
+// with the same rules of the go/ast package.
+func isDirective(comment string) bool {
+	c, ok := strings.CutPrefix(comment, "//")
+	if !ok {
+		return false
+	}
+
+	if strings.HasPrefix(c, "line ") || strings.HasPrefix(c, "extern ") || strings.HasPrefix(c, "export ") {
+		return true
+	}
+
+	// a directive is a lowercase prefix followed by a colon, like go:embed
+	colon := strings.Index(c, ":")
+	if colon <= 0 || colon+1 >= len(c) {
+		return false
+	}
+	for i := 0; i <= colon+1; i++ {
+		if i == colon {
+			continue
+		}
+		b := c[i]
+		if !('a' <= b && b <= 'z' || '0' <= b && b <= '9') {
+			return false
+		}
+	}
 
-	return s
+	return true
 }
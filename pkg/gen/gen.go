@@ -2,9 +2,12 @@ package gen
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/build/constraint"
 	"go/token"
+	"go/types"
 	"os"
 	"path/filepath"
 	"slices"
@@ -17,190 +20,448 @@ import (
 	"golang.org/x/tools/imports"
 )
 
-func GenerateStubs(inputDir string, patterns []string, outputDir string, generateGoMod bool, allowImports []string, functionBodies map[string]string) error {
-	if generateGoMod {
-		log.Debugf("generating go.mod file")
-		goModFile, err := os.ReadFile(filepath.Join(inputDir, "go.mod"))
-		if err != nil {
-			return err
-		}
+// Options configures the generation of the stubs.
+type Options struct {
+	// GenerateGoMod generates the go.mod file in the root of the stub module.
+	GenerateGoMod bool
+	// GoVersion is the go version of the generated go.mod files, like 1.22.
+	// The one of the source module is used when empty.
+	GoVersion string
+	// AllowImports lists the external packages that are kept in the stubs.
+	AllowImports []string
+	// FunctionBodies maps a function key, like pkg.(*Type).Method,
+	// to the body used in place of panic("stub").
+	FunctionBodies map[string]string
+	// KeepGoing generates the stubs of all the packages even if some of them fail,
+	// the errors are returned together at the end.
+	KeepGoing bool
+	// Layout selects how the stubs of a package are split in files,
+	// it's LayoutPackage when empty.
+	Layout string
+	// GOOS and GOARCH select the target platform of the loaded packages,
+	// the ones of the environment are used when empty.
+	GOOS   string
+	GOARCH string
+	// Tags lists the build tags used to load the packages.
+	Tags []string
+	// Env lists additional environment variables, in the KEY=VALUE form,
+	// used to load the packages.
+	Env []string
+	// Platforms lists the goos/goarch pairs the packages are loaded for,
+	// like linux/amd64. The declarations that differ between the platforms
+	// are written in files guarded by a build constraint.
+	// It requires LayoutFile and overrides GOOS and GOARCH.
+	Platforms []string
+	// KeepBodies lists the functions, with the same keys of FunctionBodies,
+	// whose original body is kept in the stub. The functions and the variable
+	// initializers of the package used by the bodies are kept too.
+	KeepBodies []string
+	// StubModules lists the modules whose packages are stubbed, instead of the
+	// packages matching the patterns. The patterns select the packages of the
+	// consumer module in the input directory: the packages of the listed modules
+	// they import, transitively, are stubbed in a module for every listed module,
+	// and the consumer go.mod is edited to replace the modules with the stubs.
+	StubModules []string
+	// WorkFile is the go.work file, created or updated, that uses the consumer
+	// module and replaces the stubbed modules. The consumer go.mod is not edited
+	// when it's set.
+	WorkFile string
+	// KeepDocs copies the doc comments of the package and of the declarations in the stubs.
+	KeepDocs bool
+	// StubNote is a line added to the doc comments of the stubbed functions,
+	// like "This function is a stub.". No line is added when it's empty.
+	StubNote string
+}
 
-		goMod, err := modfile.Parse("go.mod", goModFile, nil)
-		if err != nil {
-			return err
-		}
+const (
+	// LayoutPackage writes the stubs of a package in a single <pkg>.go file.
+	LayoutPackage = "package"
+	// LayoutFile writes a stub file for every source file, with the same name.
+	// The helper declarations are written in a dedicated file.
+	LayoutFile = "file"
+)
 
-		genGoModPath := filepath.Join(outputDir, goMod.Module.Mod.Path)
-		err = os.MkdirAll(genGoModPath, 0o755)
-		if err != nil {
-			return err
-		}
+// helpersFileName is the file of the helper declarations, like Embedme,
+// when the stubs are written with LayoutFile.
+const helpersFileName = "zz_gostubpkg_helpers.go"
+
+// stubFile collects the stubs written in a single file.
+type stubFile struct {
+	name string
+	// constraint is the build constraint of the file, nil if it has none.
+	constraint constraint.Expr
+	// doc is the package doc comment, nil if it has none.
+	doc  *ast.CommentGroup
+	body bytes.Buffer
+	// used collects the import paths of the packages referenced by the body.
+	used map[string]struct{}
+	// content is the formatted source of the file, without the build constraint.
+	content []byte
+}
 
-		genGoModFile, err := os.Create(filepath.Join(genGoModPath, "go.mod"))
-		if err != nil {
-			return err
-		}
+func GenerateStubs(inputDir string, patterns []string, outputDir string, opts Options) error {
+	switch opts.Layout {
+	case "", LayoutPackage, LayoutFile:
+	default:
+		return fmt.Errorf("unknown layout %q, expected %q or %q", opts.Layout, LayoutPackage, LayoutFile)
+	}
 
-		_, err = genGoModFile.WriteString("module " + goMod.Module.Mod.Path + "\n\n")
-		if err != nil {
-			return err
+	if len(opts.Platforms) > 0 {
+		// the stubs of the different platforms can be merged only file by file
+		if opts.Layout == LayoutPackage {
+			return fmt.Errorf("the %q layout cannot be used with multiple platforms", LayoutPackage)
 		}
+		opts.Layout = LayoutFile
 
-		_, err = genGoModFile.WriteString("go " + goMod.Go.Version + "\n")
-		if err != nil {
-			return err
+		for _, platform := range opts.Platforms {
+			if _, _, err := splitPlatform(platform); err != nil {
+				return err
+			}
 		}
 	}
 
-	pkgs, err := loadPackages(inputDir, patterns)
-	if err != nil {
+	if opts.GoVersion != "" && !modfile.GoVersionRE.MatchString(opts.GoVersion) {
+		return fmt.Errorf("invalid go version %q, expected a version like 1.22", opts.GoVersion)
+	}
+
+	if len(opts.StubModules) > 0 {
+		return generateModules(inputDir, patterns, outputDir, opts)
+	}
+
+	modules, err := generatePackages(inputDir, patterns, outputDir, opts, nil)
+	if err != nil && (!opts.KeepGoing || !errors.As(err, new(Errors))) {
 		return err
 	}
 
-	if len(pkgs) == 0 {
-		return fmt.Errorf("no packages found in %s", strings.Join(patterns, ", "))
+	// the errors of the packages are reported after the go.mod files are written
+	if opts.GenerateGoMod {
+		for _, mod := range modules {
+			goModErr := writeGoMod(inputDir, outputDir, mod, modules, opts)
+			if goModErr != nil {
+				return goModErr
+			}
+		}
 	}
 
-	for _, pkg := range pkgs {
-		log.Debugf("generating stubs for package %s", pkg.PkgPath)
+	return err
+}
 
-		err := os.MkdirAll(filepath.Join(outputDir, pkg.PkgPath), 0o755)
+// generatePackages generates the stubs of the packages matching the patterns.
+// The packages listed in stubbed are stubbed too, so their types are kept.
+// It returns the source modules of the written stubs, sorted by path,
+// with the import paths referenced by their stubs.
+func generatePackages(inputDir string, patterns []string, outputDir string, opts Options, stubbed map[string]bool) ([]*sourceModule, error) {
+	// The environment platform is used when no platform is given.
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{""}
+	}
+
+	var (
+		errs    Errors
+		pkgPath []string
+		stubs   = make(map[string][]platformFiles)
+		failed  = make(map[string]bool)
+		modules = make(map[string]*packages.Module)
+	)
+	for _, platform := range platforms {
+		classifier, pkgPaths, err := newImportClassifier(inputDir, patterns, platformOptions(opts, platform))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		buf := bytes.NewBuffer(nil)
-
-		_, err = buf.WriteString("package " + pkg.Name + "\n\n")
+		pkgs, err := loadPackages(inputDir, pkgPaths, platformOptions(opts, platform))
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		// the external packages are removed, unless they are allowed or stubbed too
+		allowed := func(pkgPath string) bool {
+			return classifier.classify(pkgPath) != importExternal || slices.Contains(opts.AllowImports, pkgPath) || stubbed[pkgPath]
 		}
-		// Get all the imports from the package and add it to the file
-		// A the end we will programmatically use "goimports" on the generated file to fix the imports
-		importedPackagesSet := make(map[string]struct{})
-		for _, astFile := range pkg.Syntax {
-			if ast.IsGenerated(astFile) {
+
+		for _, pkg := range pkgs {
+			if _, ok := stubs[pkg.PkgPath]; !ok {
+				pkgPath = append(pkgPath, pkg.PkgPath)
+			}
+			if pkg.Module != nil {
+				modules[pkg.PkgPath] = pkg.Module
+			}
+
+			files, err := renderPackage(pkg, outputDir, allowed, opts)
+			if err == nil {
+				stubs[pkg.PkgPath] = append(stubs[pkg.PkgPath], platformFiles{platform: platform, files: files})
 				continue
 			}
 
-			for _, o := range astFile.Imports {
-				if isThirdParty(o.Path.Value, allowImports) && !isLocalImport(o.Path.Value, pkgs) {
-					continue
-				}
+			if !opts.KeepGoing {
+				return nil, err
+			}
 
-				if o.Name != nil {
-					if _, ok := importedPackagesSet[o.Name.Name]; ok {
-						continue
-					}
+			log.Errorf("failed to generate stubs for package %s", pkg.PkgPath)
+			failed[pkg.PkgPath] = true
+			if pkgErrs, ok := err.(Errors); ok {
+				errs = append(errs, pkgErrs...)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	}
 
-					_, err := buf.WriteString("import " + o.Name.Name + " " + o.Path.Value + "\n\n")
-					if err != nil {
-						return err
-					}
-					importedPackagesSet[o.Name.Name] = struct{}{}
-				} else {
-					name := o.Path.Value[strings.LastIndex(o.Path.Value, "/")+1:]
-					name = strings.ReplaceAll(name, "\"", "")
-					if _, ok := importedPackagesSet[name]; ok {
-						continue
-					}
+	// A package is written only if it can be stubbed for all the platforms.
+	sources := make(map[string]*sourceModule)
+	for _, path := range pkgPath {
+		if failed[path] {
+			continue
+		}
 
-					_, err := buf.WriteString("import " + o.Path.Value + "\n\n")
-					if err != nil {
-						return err
-					}
-					importedPackagesSet[name] = struct{}{}
-				}
-			}
+		files := mergePlatforms(stubs[path])
+		err := writePackage(filepath.Join(outputDir, path), files)
+		if err != nil {
+			return nil, err
 		}
 
-		importedPackages := []string{}
-		for k := range importedPackagesSet {
-			importedPackages = append(importedPackages, k)
+		module, ok := modules[path]
+		if !ok {
+			log.Warnf("package %s is not in a module", path)
+			continue
 		}
 
-		for _, astFile := range pkg.Syntax {
-			if ast.IsGenerated(astFile) {
-				continue
-			}
+		src, ok := sources[module.Path]
+		if !ok {
+			src = &sourceModule{module: module}
+			sources[module.Path] = src
+		}
+		src.pkgPaths = append(src.pkgPaths, path)
 
-			err = stubConstsVars(astFile, buf, importedPackages)
+		// the imports are read from the formatted files,
+		// since goimports adds the ones of the function bodies
+		for _, file := range files {
+			fileImports, err := parseImports(file)
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			err = stubTypes(astFile, buf, importedPackages)
-			if err != nil {
-				return err
+			for _, imported := range fileImports {
+				if !slices.Contains(src.imports, imported) {
+					src.imports = append(src.imports, imported)
+				}
 			}
+		}
+	}
 
-			err = stubFunctions(astFile, buf, pkg.Name, functionBodies, importedPackages)
-			if err != nil {
-				return err
+	result := []*sourceModule{}
+	for _, src := range sources {
+		sort.Strings(src.imports)
+		result = append(result, src)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].module.Path < result[j].module.Path
+	})
+
+	if len(errs) > 0 {
+		return result, errs
+	}
+
+	return result, nil
+}
+
+// renderPackage renders the stub files of a single package.
+// It fails if any of the declarations of the package fails to be stubbed.
+func renderPackage(pkg *packages.Package, outputDir string, allowed func(pkgPath string) bool, opts Options) ([]*stubFile, error) {
+	log.Debugf("generating stubs for package %s", pkg.PkgPath)
+
+	// The stubs are rendered from the type checker,
+	// they cannot be trusted if the package doesn't compile.
+	if len(pkg.Errors) > 0 {
+		// The build errors reported by go list repeat the ones
+		// of the parser and the type checker.
+		onlyListErrors := !slices.ContainsFunc(pkg.Errors, func(pkgErr packages.Error) bool {
+			return pkgErr.Kind != packages.ListError
+		})
+
+		errs := Errors{}
+		for _, pkgErr := range pkg.Errors {
+			if pkgErr.Kind == packages.ListError && !onlyListErrors {
+				continue
 			}
+			errs = append(errs, newPackageError(pkg, pkgErr))
+		}
+		return nil, errs
+	}
+
+	s := newStubber(pkg, allowed)
+	s.keepDocs = opts.KeepDocs
+	s.stubNote = opts.StubNote
+	s.collectKeptBodies(opts.KeepBodies)
+
+	// The declarations are rendered first, so that only the packages they
+	// reference are imported.
+	files := []*stubFile{}
+	if opts.Layout != LayoutFile {
+		files = append(files, &stubFile{name: pkg.Name + ".go", used: s.used})
+	}
+	for _, astFile := range pkg.Syntax {
+		if ast.IsGenerated(astFile) {
+			continue
+		}
+
+		// every source file gets its own stub file and import block,
+		// guarded by the same build constraint
+		if opts.Layout == LayoutFile {
+			s.used = make(map[string]struct{})
+			files = append(files, &stubFile{
+				name:       filepath.Base(pkg.Fset.File(astFile.Pos()).Name()),
+				constraint: fileConstraint(astFile),
+				used:       s.used,
+			})
+		}
+		file := files[len(files)-1]
+		body := &file.body
 
+		// the package doc comment is usually written in a single file
+		if file.doc == nil {
+			file.doc = astFile.Doc
 		}
 
-		_, err = buf.WriteString("type Embedme interface{}\n\n")
+		err := s.stubConstsVars(astFile, body)
 		if err != nil {
-			return (err)
+			return nil, err
 		}
 
-		// The file is created before since the imports.Process() function
-		// requires to know the file path.
-		outFile, err := os.Create(filepath.Join(outputDir, pkg.PkgPath, pkg.Name+".go"))
+		err = s.stubTypes(astFile, body)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		// Programmatically use "goimports"
-		res, err := imports.Process(outFile.Name(), buf.Bytes(), nil)
+		err = s.stubFunctions(astFile, body, pkg.Name, opts.FunctionBodies)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
 
-		_, err = outFile.Write(res)
+	if len(s.errs) > 0 {
+		return nil, s.errs
+	}
+
+	// The helper declarations are shared by all the files of the package.
+	// With the file layout they get their own file, also when all the
+	// source files are generated and no other stub file is written.
+	var helpers *stubFile
+	if opts.Layout == LayoutFile {
+		helpers = &stubFile{name: helpersFileName}
+		files = append(files, helpers)
+	} else {
+		helpers = files[0]
+	}
+	_, err := helpers.body.WriteString("type Embedme interface{}\n\n")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		err = s.formatFile(filepath.Join(outputDir, pkg.PkgPath, file.name), file)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return files, nil
 }
 
-// isThirdParty checks if the given import path is a third party package. (no standard library)
-func isThirdParty(importPath string, allowImports []string) bool {
-	if slices.Contains(allowImports, strings.ReplaceAll(importPath, "\"", "")) {
-		return false
+// formatFile formats the source of a stub file of the package.
+func (s *stubber) formatFile(path string, file *stubFile) error {
+	buf := bytes.NewBuffer(nil)
+
+	_, err := buf.WriteString(s.formatDoc(file.doc, false) + "package " + s.pkg.Name + "\n\n")
+	if err != nil {
+		return err
+	}
+
+	// At the end we will programmatically use "goimports" on the generated file
+	// to group the imports and to add the ones needed by the function bodies.
+	err = s.writeImports(buf, file.used)
+	if err != nil {
+		return err
 	}
-	// Third party package import path usually contains "." (".com", ".org", ...)
-	// This logic is taken from golang.org/x/tools/imports package.
-	return strings.Contains(importPath, ".")
+
+	_, err = buf.Write(file.body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// Programmatically use "goimports",
+	// the path is used to resolve the imports of the function bodies.
+	file.content, err = imports.Process(path, buf.Bytes(), nil)
+	return err
 }
 
-// isLocalImport checks if the given import path is local to the given packages.
-func isLocalImport(importPath string, pkgs []*packages.Package) bool {
-	for _, pkg := range pkgs {
-		if "\""+pkg.PkgPath+"\"" == importPath {
-			return true
+// writePackage writes the stub files of a package in the given directory.
+func writePackage(dir string, files []*stubFile) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		log.Debugf("writing %s", path)
+
+		content := file.content
+		if file.constraint != nil {
+			content = append([]byte("//go:build "+file.constraint.String()+"\n\n"), content...)
+		}
+
+		err = os.WriteFile(path, content, 0o644)
+		if err != nil {
+			return err
 		}
 	}
-	return false
+
+	return nil
 }
 
 // loadPackages loads packages from patterns.
-func loadPackages(inputDir string, patterns []string) ([]*packages.Package, error) {
+func loadPackages(inputDir string, patterns []string, opts Options) ([]*packages.Package, error) {
+	mode := packages.NeedName |
+		packages.NeedTypes |
+		packages.NeedTypesInfo |
+		packages.NeedSyntax |
+		packages.NeedModule
+
+	return load(inputDir, patterns, opts, mode)
+}
+
+// load loads packages from patterns with the given mode,
+// the files are selected for the target platform and the build tags of the options.
+func load(inputDir string, patterns []string, opts Options, mode packages.LoadMode) ([]*packages.Package, error) {
 	config := &packages.Config{
-		Mode: packages.NeedName |
-			packages.NeedTypes |
-			packages.NeedSyntax,
-		Dir: inputDir,
+		Mode: mode,
+		Dir:  inputDir,
+		Env:  buildEnv(opts),
+	}
+
+	if len(opts.Tags) > 0 {
+		config.BuildFlags = []string{"-tags=" + strings.Join(opts.Tags, ",")}
 	}
 
 	return packages.Load(config, patterns...)
 }
 
-func stubConstsVars(astFile *ast.File, buf *bytes.Buffer, importedPackages []string) error {
+// buildEnv returns the environment of the build system's query tool.
+// The later variables override the earlier ones.
+func buildEnv(opts Options) []string {
+	env := os.Environ()
+	if opts.GOOS != "" {
+		env = append(env, "GOOS="+opts.GOOS)
+	}
+	if opts.GOARCH != "" {
+		env = append(env, "GOARCH="+opts.GOARCH)
+	}
+
+	return append(env, opts.Env...)
+}
+
+func (s *stubber) stubConstsVars(astFile *ast.File, buf *bytes.Buffer) error {
 	for _, xdecl := range astFile.Decls {
 		decl, ok := xdecl.(*ast.GenDecl)
 		if !ok {
@@ -221,19 +482,52 @@ func stubConstsVars(astFile *ast.File, buf *bytes.Buffer, importedPackages []str
 			if !ok {
 				continue
 			}
-			for _, name := range valueSpec.Names {
+
+			// a multi-value initializer used by a kept body declares all the names at once
+			if decl.Tok == token.VAR && isMultiValue(valueSpec) && slices.ContainsFunc(valueSpec.Names, s.isKeptVar) {
+				err := s.writeKeptValueSpec(buf, decl, valueSpec)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			for i, name := range valueSpec.Names {
+				if name.Name == "_" {
+					continue
+				}
+
 				log.Tracef("stubbing %s %s", t, name)
 
-				v := fmt.Sprintf("%s %s", t, name)
-				if len(valueSpec.Values) > 0 {
-					value, ok := valueSpec.Values[0].(*ast.BasicLit)
-					// TODO: handle other types
-					if !ok {
-						continue
+				v := s.formatDoc(specDoc(decl, valueSpec.Doc), false) + fmt.Sprintf("%s %s", t, name)
+				switch obj := s.info.Defs[name].(type) {
+				case *types.Const:
+					// Constants are written with the value computed by the
+					// type checker, this takes care of iota and expressions.
+					v += s.formatConst(obj)
+				case *types.Var:
+					var value ast.Expr
+					if len(valueSpec.Values) == len(valueSpec.Names) {
+						value = valueSpec.Values[i]
+					}
+
+					if !s.kept.vars[obj] {
+						v += s.formatVar(obj, valueSpec.Type != nil, value)
+						break
+					}
+
+					// the initializer is used by a kept body
+					if valueSpec.Type != nil {
+						v += " " + s.formatType(obj.Type())
 					}
-					v += fmt.Sprintf(" = %s", value.Value)
-				} else {
-					v += fmt.Sprintf(" %s", formatType(valueSpec.Type, importedPackages))
+					src, err := s.formatSource(value)
+					if err != nil {
+						return err
+					}
+					v += " = " + src
+				default:
+					s.errorf(name.Pos(), name.Name, "missing type information for %s", t)
+					continue
 				}
 				v += "\n\n"
 
@@ -248,53 +542,76 @@ func stubConstsVars(astFile *ast.File, buf *bytes.Buffer, importedPackages []str
 	return nil
 }
 
-func stubTypes(astFile *ast.File, buf *bytes.Buffer, importedPackages []string) error {
-	// Order the keys to make the output deterministic
-	keys := []string{}
-	for n := range astFile.Scope.Objects {
-		keys = append(keys, n)
-	}
-	sort.Strings(keys)
-
-	for _, n := range keys {
-		// private types are create too
-		// this is needed for private embedded types in structs
-		node := astFile.Scope.Objects[n].Decl
-
-		switch ts := node.(type) {
-		case *ast.TypeSpec:
-			switch t := ts.Type.(type) {
-			case *ast.StructType:
-				log.Tracef("stubbing struct %s", n)
-				field := formatStructFields(t.Fields, importedPackages)
-				_, err := buf.WriteString("type " + n + " struct " + "{" + field + "}\n\n")
-				if err != nil {
-					return err
-				}
-			case *ast.InterfaceType:
-				log.Tracef("stubbing interface %s", n)
-				i := "type " + n + " interface {\n"
-				for _, method := range t.Methods.List {
-					m, ok := method.Type.(*ast.FuncType)
-					if !ok {
-						// TODO: handle embedded interfaces
-						log.Debugf("skipping embedded interface %s", method.Names[0].Name)
-						continue
-					}
-					i += fmt.Sprintf("%s(%s) %s\n", method.Names[0].Name, formatFields(m.Params, importedPackages), formatFuncResults(m.Results, importedPackages))
-				}
-				i += "}\n\n"
-				_, err := buf.WriteString(i)
-				if err != nil {
-					return err
-				}
+func (s *stubber) stubTypes(astFile *ast.File, buf *bytes.Buffer) error {
+	typeSpecs := []*ast.TypeSpec{}
+	docs := make(map[*ast.TypeSpec]*ast.CommentGroup)
+	for _, xdecl := range astFile.Decls {
+		decl, ok := xdecl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if s.info.Defs[ts.Name] == nil {
+				s.errorf(ts.Pos(), ts.Name.Name, "missing type information for type")
+				continue
+			}
+			typeSpecs = append(typeSpecs, ts)
+			docs[ts] = specDoc(decl, ts.Doc)
+		}
+	}
 
-			default:
-				log.Tracef("stubbing type %s", n)
-				_, err := buf.WriteString("type " + n + " " + formatType(ts.Type, importedPackages) + "\n\n")
-				if err != nil {
-					return err
-				}
+	// Order the types to make the output deterministic
+	sort.Slice(typeSpecs, func(i, j int) bool {
+		return typeSpecs[i].Name.Name < typeSpecs[j].Name.Name
+	})
+
+	// private types are create too
+	// this is needed for private embedded types in structs
+	for _, ts := range typeSpecs {
+		n := ts.Name.Name
+		doc := s.formatDoc(docs[ts], false)
+
+		// aliases are kept as aliases, otherwise the stub would declare a
+		// new type that is not assignable to the original one
+		if alias, ok := s.info.Defs[ts.Name].Type().(*types.Alias); ok && ts.Assign.IsValid() {
+			n += s.formatTypeParams(alias.TypeParams())
+			log.Tracef("stubbing alias %s", n)
+			_, err := buf.WriteString(doc + "type " + n + " = " + s.formatType(alias.Rhs()) + "\n\n")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// generic types are declared with their type parameters, like List[T any]
+		if named, ok := s.info.Defs[ts.Name].Type().(*types.Named); ok {
+			n += s.formatTypeParams(named.TypeParams())
+		}
+
+		switch t := s.info.TypeOf(ts.Type).(type) {
+		case *types.Struct:
+			log.Tracef("stubbing struct %s", n)
+			field := s.formatStructFields(t)
+			_, err := buf.WriteString(doc + "type " + n + " struct " + "{" + field + "}\n\n")
+			if err != nil {
+				return err
+			}
+		case *types.Interface:
+			log.Tracef("stubbing interface %s", n)
+			i := doc + "type " + n + " interface {\n"
+			i += s.formatInterfaceElems(t)
+			i += "}\n\n"
+			_, err := buf.WriteString(i)
+			if err != nil {
+				return err
+			}
+
+		default:
+			log.Tracef("stubbing type %s", n)
+			_, err := buf.WriteString(doc + "type " + n + " " + s.formatType(t) + "\n\n")
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -302,40 +619,50 @@ func stubTypes(astFile *ast.File, buf *bytes.Buffer, importedPackages []string)
 	return nil
 }
 
-func stubFunctions(astFile *ast.File, buf *bytes.Buffer, pkgName string, functionsBodies map[string]string, importedPackages []string) error {
+func (s *stubber) stubFunctions(astFile *ast.File, buf *bytes.Buffer, pkgName string, functionsBodies map[string]string) error {
 	for _, xdecl := range astFile.Decls {
 		decl, ok := xdecl.(*ast.FuncDecl)
 		if !ok {
 			continue
 		}
 
-		if isInterfaceDecl(decl) {
+		// the unexported functions are needed only by the kept bodies
+		fn, _ := s.info.Defs[decl.Name].(*types.Func)
+		kept := s.kept.funcs[fn]
+		if !ast.IsExported(decl.Name.Name) && !kept {
 			continue
 		}
 
-		if !ast.IsExported(decl.Name.Name) {
+		symbol, err := funcSymbol(decl)
+		if err != nil {
+			s.errorf(decl.Pos(), decl.Name.Name, "%w", err)
 			continue
 		}
 
-		foo := formatFuncDecl(decl, importedPackages)
-
-		// check if function body is provided
-		recv := getRecvType(decl)
-		if recv != "" {
-			recv = fmt.Sprintf(".%s", recv)
+		foo, err := s.formatFuncDecl(decl)
+		if err != nil {
+			s.errorf(decl.Pos(), symbol, "%w", err)
+			continue
 		}
 
-		key := fmt.Sprintf("%s%s.%s", pkgName, recv, decl.Name.Name)
+		key := fmt.Sprintf("%s.%s", pkgName, symbol)
 
 		log.Tracef("stubbing function %s", key)
 		if body, ok := functionsBodies[key]; ok {
 			log.Tracef("using stub body for %s", key)
-			foo += "{" + body + "\n}\n\n"
+			foo = s.formatDoc(decl.Doc, true) + foo + "{" + body + "\n}\n\n"
+		} else if kept {
+			log.Tracef("keeping the original body of %s", key)
+			body, err := s.formatSource(decl.Body)
+			if err != nil {
+				return err
+			}
+			foo = s.formatDoc(decl.Doc, false) + foo + " " + body + "\n\n"
 		} else {
-			foo += " {\n panic(\"stub\")\n}\n\n"
+			foo = s.formatDoc(decl.Doc, true) + foo + " {\n panic(\"stub\")\n}\n\n"
 		}
 
-		_, err := buf.WriteString(foo)
+		_, err = buf.WriteString(foo)
 		if err != nil {
 			return err
 		}
@@ -344,49 +671,80 @@ func stubFunctions(astFile *ast.File, buf *bytes.Buffer, pkgName string, functio
 	return nil
 }
 
-// check if it's an interface method declaration
-func isInterfaceDecl(decl *ast.FuncDecl) bool {
-	if decl.Recv != nil {
-		if len(decl.Recv.List) != 1 {
-			panic(fmt.Errorf("strange receiver for %s: %#v", decl.Name.Name, decl.Recv))
-		}
+// specDoc returns the doc comment of a spec of the given declaration.
+// The doc comment of the declaration is used only if it's not a group,
+// like "// Foo ...\nvar Foo int".
+func specDoc(decl *ast.GenDecl, doc *ast.CommentGroup) *ast.CommentGroup {
+	if doc == nil && !decl.Lparen.IsValid() {
+		return decl.Doc
+	}
 
-		field := decl.Recv.List[0]
-		if len(field.Names) == 0 {
-			return true
-		}
+	return doc
+}
+
+// funcSymbol returns the name of a function, or of a method prefixed by its receiver,
+// like Foo or (*Foo).Bar.
+func funcSymbol(decl *ast.FuncDecl) (string, error) {
+	recv, err := getRecvType(decl)
+	if err != nil {
+		return "", err
+	}
+
+	if recv == "" {
+		return decl.Name.Name, nil
 	}
-	return false
+
+	return fmt.Sprintf("%s.%s", recv, decl.Name.Name), nil
 }
 
 // getRecvType get the name of a method receiver
 // Examples:
-// func (s *Struct) Foo() {} -> (*Struct)
-// func (s Struct) Foo() {}  -> (Struct)
-func getRecvType(decl *ast.FuncDecl) string {
+// func (s *Struct) Foo() {}  -> (*Struct)
+// func (s Struct) Foo() {}   -> (Struct)
+// func (l *List[T]) Foo() {} -> (*List[T])
+func getRecvType(decl *ast.FuncDecl) (string, error) {
 	if decl.Recv == nil {
-		return ""
+		return "", nil
 	}
 
 	if len(decl.Recv.List) != 1 {
-		panic(fmt.Errorf("multiple receivers for %s: %#v", decl.Name.Name, decl.Recv))
+		return "", fmt.Errorf("expected a single receiver, found %d", len(decl.Recv.List))
 	}
 
-	field := decl.Recv.List[0]
+	typ := decl.Recv.List[0].Type
+	ptr := ""
+	if t, ok := typ.(*ast.StarExpr); ok {
+		ptr = "*"
+		typ = t.X
+	}
 
-	switch t := field.Type.(type) {
+	name := getRecvTypeName(typ)
+	if name == "" {
+		// some new syntax?
+		return "", fmt.Errorf("unsupported receiver type %T", typ)
+	}
+
+	return fmt.Sprintf("(%s%s)", ptr, name), nil
+}
+
+// getRecvTypeName get the name of a receiver base type,
+// with the type parameters for generic types.
+func getRecvTypeName(typ ast.Expr) string {
+	switch t := typ.(type) {
 	case *ast.Ident:
-		return fmt.Sprintf(".(%s)", t.Name)
-	case *ast.StarExpr:
-		switch xType := t.X.(type) {
-		case *ast.Ident:
-			return fmt.Sprintf("(*%s)", xType.Name)
-		default:
-			// not an identificator?
-			return ""
+		return t.Name
+	case *ast.ParenExpr:
+		return getRecvTypeName(t.X)
+	case *ast.IndexExpr:
+		return getRecvTypeName(t.X) + "[" + getRecvTypeName(t.Index) + "]"
+	case *ast.IndexListExpr:
+		params := []string{}
+		for _, index := range t.Indices {
+			params = append(params, getRecvTypeName(index))
 		}
+		return getRecvTypeName(t.X) + "[" + strings.Join(params, ", ") + "]"
 	default:
-		// some new syntax?
+		// not an identificator?
 		return ""
 	}
 }
@@ -2,15 +2,31 @@ package gen
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/mod/modfile"
 )
 
 const (
 	inputDir = "testdata/testmod"
 	module   = "github.com/gostubpkg/testmod"
+
+	brokenInputDir = "testdata/brokenmod"
+	brokenModule   = "github.com/gostubpkg/brokenmod"
+
+	consumerInputDir = "testdata/consumermod"
+
+	legacyInputDir = "testdata/legacymod"
+	legacyModule   = "github.com/gostubpkg/legacymod"
+
+	corpInputDir = "testdata/corpmod"
+
+	workspaceInputDir = "testdata/workspace"
+	workspaceModule   = "github.com/gostubpkg/workspace"
 )
 
 type GenTestSuite struct {
@@ -23,7 +39,7 @@ func (suite *GenTestSuite) SetupTest() {
 }
 
 func (suite *GenTestSuite) TestGenerateAllPackages() {
-	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, false, nil, nil)
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{})
 	suite.NoError(err)
 
 	suite.True(suite.fileExists("main.go"))
@@ -44,7 +60,7 @@ var Var2 = "someOtherValue"
 
 const Const1 = 0
 
-const const2 = 0
+const const2 = 1
 
 func Foo(e bool) error {
 	panic("stub")
@@ -57,7 +73,7 @@ type Embedme interface{}
 }
 
 func (suite *GenTestSuite) TestGenerateStubsGoMod() {
-	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, true, nil, nil)
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{GenerateGoMod: true})
 	suite.NoError(err)
 
 	suite.True(suite.fileExists("go.mod"))
@@ -66,12 +82,158 @@ func (suite *GenTestSuite) TestGenerateStubsGoMod() {
 	expectedGoMod := `module github.com/gostubpkg/testmod
 
 go 1.26.0
+
+toolchain go1.27.0
+`
+	suite.Equal(expectedGoMod, generatedGoMod)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsGoModGoVersion() {
+	err := GenerateStubs(inputDir, []string{"./pkg/funcs"}, suite.outputDir, Options{
+		GenerateGoMod: true,
+		GoVersion:     "1.22",
+	})
+	suite.NoError(err)
+
+	generatedGoMod := suite.readFile("go.mod")
+	expectedGoMod := `module github.com/gostubpkg/testmod
+
+go 1.22
 `
 	suite.Equal(expectedGoMod, generatedGoMod)
 }
 
+func (suite *GenTestSuite) TestGenerateStubsInvalidGoVersion() {
+	err := GenerateStubs(inputDir, []string{"./pkg/funcs"}, suite.outputDir, Options{
+		GenerateGoMod: true,
+		GoVersion:     "go1.22",
+	})
+	suite.EqualError(err, `invalid go version "go1.22", expected a version like 1.22`)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsDotlessModules() {
+	err := GenerateStubs(corpInputDir, []string{"./server"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	// the packages are classified by module, not by the dot in the import path
+	generatedServer, err := os.ReadFile(filepath.Join(suite.outputDir, "mycorp/app/server/server.go"))
+	suite.Require().NoError(err)
+	expectedServer := `package server
+
+import (
+	"mycorp/app/models"
+	"net/http"
+)
+
+type Server struct {
+	Client  interface{}
+	Handler http.Handler
+	Users   []models.User
+}
+
+func (s *Server) User(name string) (*models.User, error) {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedServer, string(generatedServer))
+	suite.FileExists(filepath.Join(suite.outputDir, "mycorp/app/models/models.go"))
+	suite.NoFileExists(filepath.Join(suite.outputDir, "mycorp/lib/lib.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsWorkspace() {
+	err := GenerateStubs(workspaceInputDir, []string{"./a/...", "./b/..."}, suite.outputDir, Options{
+		GenerateGoMod: true,
+		// the workspace mode doesn't allow -mod=mod
+		Env: []string{"GOFLAGS=-mod=readonly"},
+	})
+	suite.NoError(err)
+
+	// every module of the workspace has its own stub module
+	generatedGoMod, err := os.ReadFile(filepath.Join(suite.outputDir, workspaceModule, "a", "go.mod"))
+	suite.Require().NoError(err)
+	suite.Equal(`module github.com/gostubpkg/workspace/a
+
+go 1.26.0
+`, string(generatedGoMod))
+
+	// the references to the other modules of the workspace are kept
+	generatedGoMod, err = os.ReadFile(filepath.Join(suite.outputDir, workspaceModule, "b", "go.mod"))
+	suite.Require().NoError(err)
+	suite.Equal(`module github.com/gostubpkg/workspace/b
+
+go 1.26.0
+
+require (
+	github.com/gostubpkg/workspace/a v0.0.0
+)
+
+replace github.com/gostubpkg/workspace/a => ../a
+`, string(generatedGoMod))
+
+	generatedStubs, err := os.ReadFile(filepath.Join(suite.outputDir, workspaceModule, "b", "b.go"))
+	suite.Require().NoError(err)
+	suite.Equal(`package b
+
+import "github.com/gostubpkg/workspace/a"
+
+type Controller struct{ Pods []*a.Pod }
+
+func (c *Controller) Add(pod *a.Pod) {
+	panic("stub")
+}
+
+type Embedme interface{}
+`, string(generatedStubs))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsGoModMissingGo() {
+	err := GenerateStubs(legacyInputDir, []string{"./..."}, suite.outputDir, Options{
+		GenerateGoMod: true,
+		// the go command must not add the missing go directive
+		Env: []string{"GOFLAGS=-mod=readonly"},
+	})
+	suite.NoError(err)
+
+	// the language version of the go command is used
+	generatedGoMod, err := os.ReadFile(filepath.Join(suite.outputDir, legacyModule, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Regexp(`^module github.com/gostubpkg/legacymod
+
+go 1\.\d+
+
+godebug \(
+	http2client=0
+	panicnil=1
+\)
+$`, string(generatedGoMod))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsGoModRequires() {
+	err := GenerateStubs(inputDir, []string{"./pkg/tags"}, suite.outputDir, Options{
+		GenerateGoMod: true,
+		AllowImports:  []string{"k8s.io/api/core/v1"},
+	})
+	suite.NoError(err)
+
+	// only the modules needed by the stubs are required
+	generatedGoMod := suite.readFile("go.mod")
+	suite.Contains(generatedGoMod, "require (\n\tk8s.io/api v0.36.4\n)\n")
+	suite.Contains(generatedGoMod, "\tk8s.io/apimachinery v0.36.4 // indirect\n")
+	suite.NotContains(generatedGoMod, "github.com/stretchr/testify")
+
+	generatedGoSum := suite.readFile("go.sum")
+	suite.Contains(generatedGoSum, "k8s.io/api v0.36.4 h1:")
+	suite.Contains(generatedGoSum, "k8s.io/api v0.36.4/go.mod h1:")
+	suite.NotContains(generatedGoSum, "github.com/stretchr/testify v1.12.1 h1:")
+	// the go.mod lines are the ones of the module graph of the required modules
+	suite.NotContains(generatedGoSum, "github.com/gogo/protobuf v1.3.2/go.mod h1:")
+}
+
 func (suite *GenTestSuite) TestGenerateStubsFuncsPackage() {
-	err := GenerateStubs(inputDir, []string{"./pkg/funcs"}, suite.outputDir, true, nil, nil)
+	err := GenerateStubs(inputDir, []string{"./pkg/funcs"}, suite.outputDir, Options{GenerateGoMod: true})
 	suite.NoError(err)
 
 	suite.True(suite.fileExists("pkg/funcs/funcs.go"))
@@ -99,7 +261,7 @@ type Embedme interface{}
 }
 
 func (suite *GenTestSuite) TestGenerateStubsTypesPackage() {
-	err := GenerateStubs(inputDir, []string{"./pkg/types"}, suite.outputDir, false, nil, nil)
+	err := GenerateStubs(inputDir, []string{"./pkg/types"}, suite.outputDir, Options{})
 	suite.NoError(err)
 
 	suite.True(suite.fileExists("pkg/types/types.go"))
@@ -148,111 +310,1295 @@ type Embedme interface{}
 	suite.Equal(expectedTypes, generatedTypes)
 }
 
-func (suite *GenTestSuite) TestGenerateStubsAllowImports() {
-	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, false, []string{"k8s.io/api/core/v1"}, nil)
+func (suite *GenTestSuite) TestGenerateStubsImportsPackage() {
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{})
 	suite.NoError(err)
 
-	generatedFuncs := suite.readFile("pkg/funcs/funcs.go")
-	expectedFuncs := `package funcs
+	generatedImports := suite.readFile("pkg/imports/imports.go")
+	expectedImports := `package imports
 
 import (
-	"io"
+	"bytes"
+	stdio "io"
+	"strings"
 
-	corev1 "k8s.io/api/core/v1"
+	mytypes "github.com/gostubpkg/testmod/pkg/types"
 )
 
-func Bar[T1 any, T2 int](t1 []T1, t2 T2) T2 {
+type Wrapper struct {
+	Reader  stdio.Reader
+	Builder *strings.Builder
+	Buffer  bytes.Buffer
+	Struct  *mytypes.MyStruct
+}
+
+func Copy(dst stdio.Writer, src *strings.Reader) (int64, error) {
 	panic("stub")
 }
 
-func Baz(pod *corev1.Pod, writer io.Writer, str string) error {
+func PodName(pod interface{}) string {
 	panic("stub")
 }
 
 type Embedme interface{}
 `
 
-	suite.Equal(expectedFuncs, generatedFuncs)
+	suite.Equal(expectedImports, generatedImports)
+}
 
-	generatedTypes := suite.readFile("pkg/types/types.go")
-	expectedTypes := `package types
+func (suite *GenTestSuite) TestGenerateStubsConstsPackage() {
+	err := GenerateStubs(inputDir, []string{"./pkg/consts"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedConsts := suite.readFile("pkg/consts/consts.go")
+	expectedConsts := `package consts
+
+import "time"
+
+const Pending Phase = "Pending"
+
+const Running Phase = "Running"
+
+const Debug Level = 1
+
+const Info Level = 2
+
+const Error Level = 4
+
+const KB = 1024
+
+const MB = 1048576
+
+const Timeout time.Duration = 2000000000
+
+const Min = 0
+
+const Max = 10
+
+const Pi = 3.14159265358979323846264338327950288419716939937510582097494459
+
+const Half = 0.5
+
+const Third = 1.0 / 3
+
+const Scale = 2.0
+
+const Letter = 'a'
+
+const Imag = complex(1, 2.0)
+
+const Tiny = -0.0009765625
+
+const Yes = true
+
+const Succeeded string = "Succeeded"
+
+const Failed string = "Failed"
+
+const Ratio float32 = 0.100000001490116119384765625
+
+type ExtPhase interface{}
+
+type Level int
+
+type Phase string
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedConsts, generatedConsts)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsVarsPackage() {
+	err := GenerateStubs(inputDir, []string{"./pkg/vars"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedVars := suite.readFile("pkg/vars/vars.go")
+	expectedVars := `package vars
 
 import (
-	"io"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+)
 
-	corev1 "k8s.io/api/core/v1"
+var ErrNotFound = errors.New("not found")
+
+var ErrInvalid = fmt.Errorf("invalid: %w", ErrNotFound)
+
+var ErrExternal = fmt.Errorf("external: %w", os.ErrNotExist)
+
+var ErrLimit = fmt.Errorf("over %d%% of %s: %w", 90, "the quota", ErrInvalid)
+
+var ErrRemoved = errors.New("pod is")
+
+var DefaultClient *Client
+
+var Clients map[string]*Client
+
+var Transport http.RoundTripper
+
+var Pod interface{}
+
+var Timeout int64 = 30
+
+var Host = "localhost"
+
+var Port = 8080
+
+var stdout *os.File
+
+type Client struct{ Name string }
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedVars, generatedVars)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsEmbeddedInterfaces() {
+	err := GenerateStubs(inputDir, []string{"./pkg/ifaces"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedIfaces := suite.readFile("pkg/ifaces/ifaces.go")
+	expectedIfaces := `package ifaces
+
+import (
+	"fmt"
+	"io"
 )
 
-type MyEmbeddedStruct struct{}
+type Named interface {
+	named
+	fmt.Stringer
+}
 
-type MyInterface interface {
-	GetPodName(pod *corev1.Pod) string
-	getPodNamePrivate(pod *corev1.Pod) string
+type Object interface {
+	GetObjectKind() interface{}
+	DeepCopyObject() interface{}
+	GetName() string
 }
 
-type MyStruct struct {
-	MyEmbeddedStruct
-	corev1.PodSpec
-	Name     string
-	Num      int
-	Pointer  *os.File
-	IOReader io.Reader
-	Pod      corev1.Pod
+type ReadCloser interface {
+	io.Reader
+	Close() error
 }
 
-type MyTypeAlias string
+type named interface {
+	Name() string
+}
 
-type MyTypeAlias2 MyStruct
+type Embedme interface{}
+`
 
-type MyTypeAlias3 corev1.Pod
+	suite.Equal(expectedIfaces, generatedIfaces)
+}
 
-func (s *MyStruct) GetPodName(pod *corev1.Pod) string {
+func (suite *GenTestSuite) TestGenerateStubsGenerics() {
+	err := GenerateStubs(inputDir, []string{"./pkg/generics"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedGenerics := suite.readFile("pkg/generics/generics.go")
+	expectedGenerics := `package generics
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+type Box[T any] struct{ value atomic.Pointer[T] }
+
+type Getter[T any] interface {
+	Get() T
+}
+
+type List[T any] struct {
+	items []T
+	Head  *List[T]
+}
+
+type Named[T fmt.Stringer] struct{ Value T }
+
+type NamedPod Named[fmt.Stringer]
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Phased[T ~string] struct{ Value T }
+
+type PodGetter Getter[interface{}]
+
+type PodPhase Phased[string]
+
+type Pods List[interface{}]
+
+type Strings List[string]
+
+func Map[K, V any](in []K, fn func(K) V) []V {
+	panic("stub")
+}
+
+func First[T any, L List[T]](l L) Pair[int, T] {
+	panic("stub")
+}
+
+func (l *List[T]) Push(v T) {
+	panic("stub")
+}
+
+func (p Pair[K, V]) String() string {
+	panic("stub")
+}
+
+func Push[T any](l *List[T], v T) {
 	panic("stub")
 }
 
 type Embedme interface{}
 `
 
-	suite.Equal(expectedTypes, generatedTypes)
+	suite.Equal(expectedGenerics, generatedGenerics)
 }
 
-func (suite *GenTestSuite) TestGenerateStubsFunctionBodies() {
-	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, false, nil, map[string]string{
-		"funcs.Bar":                    `panic("i don't like generics")`,
-		"types.(*MyStruct).GetPodName": `return "StubPodName"`,
-	})
+func (suite *GenTestSuite) TestGenerateStubsConstraints() {
+	err := GenerateStubs(inputDir, []string{"./pkg/constraints"}, suite.outputDir, Options{})
 	suite.NoError(err)
 
-	generatedFuncs := suite.readFile("pkg/funcs/funcs.go")
-	suite.Contains(generatedFuncs, `func Bar[T1 any, T2 int](t1 []T1, t2 T2) T2 {
-	panic("i don't like generics")
-`)
+	generatedConstraints := suite.readFile("pkg/constraints/constraints.go")
+	expectedConstraints := `package constraints
 
-	generatedTypes := suite.readFile("pkg/types/types.go")
-	suite.Contains(generatedTypes, `func (s *MyStruct) GetPodName(pod interface{}) string {
-	return "StubPodName"
+import "fmt"
+
+type Integer interface {
+	~int
 }
-`)
+
+type Number interface {
+	~int | ~int64 | ~float64
 }
 
-func (suite *GenTestSuite) filePath(filename string) string {
-	return filepath.Join(suite.outputDir, module, filename)
+type OnlyPhase interface {
+	comparable
 }
 
-func (suite *GenTestSuite) fileExists(filename string) bool {
-	info, err := os.Stat(suite.filePath(filename))
-	if os.IsNotExist(err) {
-		return false
-	}
-	return !info.IsDir()
+type Phase interface {
+	string
 }
 
-func (suite *GenTestSuite) readFile(filename string) string {
-	file, err := os.ReadFile(suite.filePath(filename))
+type PodSpecs interface {
+}
+
+type Ptr[T *int,] struct{ v T }
+
+type Ref[T *int | *string,] struct{ v T }
+
+type Stringish interface {
+	~string
+	fmt.Stringer
+}
+
+func Sum[T Number](values ...T) T {
+	panic("stub")
+}
+
+func Len[T ~string | ~[]byte](v T) int {
+	panic("stub")
+}
+
+func Name[T any](obj T) string {
+	panic("stub")
+}
+
+func Deref[T *int](p T) int {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedConstraints, generatedConstraints)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsReceivers() {
+	err := GenerateStubs(inputDir, []string{"./pkg/receivers"}, suite.outputDir, Options{})
 	suite.NoError(err)
 
-	return string(file)
+	generatedReceivers := suite.readFile("pkg/receivers/receivers.go")
+	expectedReceivers := `package receivers
+
+type T struct{}
+
+func (*T) Unnamed() {
+	panic("stub")
+}
+
+func (_ T) Blank() string {
+	panic("stub")
+}
+
+func (t *T) Named() {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedReceivers, generatedReceivers)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsStopsOnError() {
+	err := GenerateStubs(brokenInputDir, []string{"./..."}, suite.outputDir, Options{})
+	suite.Error(err)
+
+	suite.NoFileExists(filepath.Join(suite.outputDir, brokenModule, "good/good.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsKeepGoing() {
+	err := GenerateStubs(brokenInputDir, []string{"./..."}, suite.outputDir, Options{KeepGoing: true})
+	suite.Error(err)
+
+	var errs Errors
+	suite.Require().ErrorAs(err, &errs)
+	suite.Len(errs, 1)
+
+	var stubErr *Error
+	suite.Require().ErrorAs(err, &stubErr)
+	suite.Equal(brokenModule+"/bad", stubErr.Package)
+	suite.True(strings.HasSuffix(stubErr.File, filepath.Join("bad", "bad.go")))
+	suite.Equal(3, stubErr.Line)
+	suite.Contains(stubErr.Error(), "undefined: Missing")
+
+	suite.FileExists(filepath.Join(suite.outputDir, brokenModule, "good/good.go"))
+	suite.NoFileExists(filepath.Join(suite.outputDir, brokenModule, "bad/bad.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsStructTags() {
+	err := GenerateStubs(inputDir, []string{"./pkg/tags"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedTags := suite.readFile("pkg/tags/tags.go")
+	expectedTags := `package tags
+
+type Config struct {
+	Embedme    ` + "`json:\",inline\"`" + `
+	ObjectMeta interface{}       ` + "`json:\"metadata,omitempty\"`" + `
+	Name       string            ` + "`json:\"name\" yaml:\"name\"`" + `
+	Labels     map[string]string ` + "`json:\"labels,omitempty\"`" + `
+	Pod        interface{}       ` + "`json:\"pod\" protobuf:\"bytes,1,opt,name=pod\"`" + `
+	Raw        string            "raw:\"` + "`" + `\""
+	plain      int
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedTags, generatedTags)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsInlineTypes() {
+	err := GenerateStubs(inputDir, []string{"./pkg/inline"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedInline := suite.readFile("pkg/inline/inline.go")
+	suite.Contains(generatedInline, `type Config struct {
+	Options struct {
+		Timeout int `+"`json:\"timeout\"`"+`
+		Retries int
+		Pod     interface{} `+"`json:\"pod\"`"+`
+		Embedme
+	} `+"`json:\"options\"`"+`
+	Hooks    []struct{ Name string }
+	Callback func(ctx context.Context, pod interface{}) error
+}
+`)
+	suite.Contains(generatedInline, `func Write(w interface {
+	io.Closer
+	Write([]byte) (int, error)
+}, data []byte) error {
+`)
+	// the methods of the removed metav1.Object are inlined
+	suite.Contains(generatedInline, `func Handle(obj interface {
+	GetAnnotations() map[string]string
+`)
+	suite.Contains(generatedInline, `	SetUID(uid interface{})
+	GetName() string
+}) {
+`)
+	suite.Contains(generatedInline, `func Point() struct {
+	X int
+	Y int
+} {
+`)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsArrayLengths() {
+	err := GenerateStubs(inputDir, []string{"./pkg/arrays"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedArrays := suite.readFile("pkg/arrays/arrays.go")
+	expectedArrays := `package arrays
+
+const N = 4
+
+var names [3]string
+
+type Block struct {
+	Words [8]uint32
+	Names [3]string
+	UIDs  [4]interface{}
+}
+
+type Digest [32]byte
+
+func Sum(data []byte) [32]byte {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedArrays, generatedArrays)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsAliases() {
+	err := GenerateStubs(inputDir, []string{"./pkg/aliases"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedAliases := suite.readFile("pkg/aliases/aliases.go")
+	expectedAliases := `package aliases
+
+import "net/http"
+
+const Pending string = "Pending"
+
+type Handler = http.Handler
+
+type Names = Set[string]
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Phase = interface{}
+
+type Pod = interface{}
+
+type PodList = []interface{}
+
+type PodRef struct {
+	Embedme
+	Phase interface{}
+}
+
+type Set[T comparable] = map[T]struct{}
+
+type StringPair[V any] = Pair[string, V]
+
+func Serve(h Handler, pods PodList) Names {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedAliases, generatedAliases)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsImportNames() {
+	err := GenerateStubs(inputDir, []string{"./pkg/naming"}, suite.outputDir, Options{AllowImports: []string{"k8s.io/api/core/v1"}})
+	suite.NoError(err)
+
+	// the packages are named after their declaration, and the conflicting names are renamed
+	generatedNaming := suite.readFile("pkg/naming/naming.go")
+	expectedNaming := `package naming
+
+import (
+	otherv1 "github.com/gostubpkg/testmod/pkg/naming/other/v1"
+	versioned "github.com/gostubpkg/testmod/pkg/naming/versioned/v2"
+	yaml "github.com/gostubpkg/testmod/pkg/naming/yaml.v3"
+	v1 "k8s.io/api/core/v1"
+)
+
+type A struct {
+	Pod  v1.Pod
+	Node yaml.Node
+}
+
+type B struct {
+	Item    otherv1.Item
+	Version versioned.Version
+}
+
+func NewB(item otherv1.Item) *B {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedNaming, generatedNaming)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsFileLayout() {
+	err := GenerateStubs(inputDir, []string{"./pkg/imports"}, suite.outputDir, Options{Layout: LayoutFile})
+	suite.NoError(err)
+
+	suite.NoFileExists(suite.filePath("pkg/imports/imports.go"))
+
+	// the imported packages of the same module are stubbed too
+	suite.FileExists(suite.filePath("pkg/types/types.go"))
+
+	generatedA := suite.readFile("pkg/imports/a.go")
+	expectedA := `package imports
+
+import (
+	"bytes"
+	stdio "io"
+	"strings"
+
+	mytypes "github.com/gostubpkg/testmod/pkg/types"
+)
+
+type Wrapper struct {
+	Reader  stdio.Reader
+	Builder *strings.Builder
+	Buffer  bytes.Buffer
+	Struct  *mytypes.MyStruct
+}
+
+func Copy(dst stdio.Writer, src *strings.Reader) (int64, error) {
+	panic("stub")
+}
+`
+
+	suite.Equal(expectedA, generatedA)
+
+	generatedB := suite.readFile("pkg/imports/b.go")
+	expectedB := `package imports
+
+func PodName(pod interface{}) string {
+	panic("stub")
+}
+`
+
+	suite.Equal(expectedB, generatedB)
+
+	generatedHelpers := suite.readFile("pkg/imports/zz_gostubpkg_helpers.go")
+	expectedHelpers := `package imports
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedHelpers, generatedHelpers)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsFileLayoutAllPackages() {
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{Layout: LayoutFile})
+	suite.NoError(err)
+
+	suite.FileExists(suite.filePath("main.go"))
+	suite.FileExists(suite.filePath("pkg/types/types.go"))
+
+	// the package with only generated files gets just the helpers
+	suite.NoFileExists(suite.filePath("pkg/types/mocks/MyInterface.go"))
+	suite.Equal("package mocks\n\ntype Embedme interface{}\n", suite.readFile("pkg/types/mocks/zz_gostubpkg_helpers.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsUnknownLayout() {
+	err := GenerateStubs(inputDir, []string{"./pkg/imports"}, suite.outputDir, Options{Layout: "module"})
+	suite.EqualError(err, `unknown layout "module", expected "package" or "file"`)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsTargetPlatform() {
+	err := GenerateStubs(inputDir, []string{"./pkg/platform"}, suite.outputDir, Options{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+	})
+	suite.NoError(err)
+
+	generatedLinux := suite.readFile("pkg/platform/platform.go")
+	expectedLinux := `package platform
+
+const WordSize = 64
+
+func Name() string {
+	panic("stub")
+}
+
+const name = "linux"
+
+func Epoll() int {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedLinux, generatedLinux)
+
+	err = GenerateStubs(inputDir, []string{"./pkg/platform"}, suite.outputDir, Options{
+		GOOS:   "wasip1",
+		GOARCH: "wasm",
+		Tags:   []string{"integration"},
+		Env:    []string{"CGO_ENABLED=0"},
+	})
+	suite.NoError(err)
+
+	generatedWasip1 := suite.readFile("pkg/platform/platform.go")
+	expectedWasip1 := `package platform
+
+func Fixture() string {
+	panic("stub")
+}
+
+const WordSize = 64
+
+func Name() string {
+	panic("stub")
+}
+
+const name = "wasip1"
+
+func Poll() int {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedWasip1, generatedWasip1)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsBuildConstraints() {
+	err := GenerateStubs(inputDir, []string{"./pkg/platform"}, suite.outputDir, Options{
+		Layout: LayoutFile,
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   []string{"integration"},
+	})
+	suite.NoError(err)
+
+	generatedIntegration := suite.readFile("pkg/platform/integration.go")
+	expectedIntegration := `//go:build integration
+
+package platform
+
+func Fixture() string {
+	panic("stub")
+}
+`
+
+	suite.Equal(expectedIntegration, generatedIntegration)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsPlatforms() {
+	err := GenerateStubs(inputDir, []string{"./pkg/platform"}, suite.outputDir, Options{
+		Platforms: []string{"linux/amd64", "linux/386", "wasip1/wasm", "js/wasm"},
+	})
+	suite.NoError(err)
+
+	// the files of a single platform keep their name
+	generatedLinux := suite.readFile("pkg/platform/platform_linux.go")
+	expectedLinux := `package platform
+
+const name = "linux"
+
+func Epoll() int {
+	panic("stub")
+}
+`
+
+	suite.Equal(expectedLinux, generatedLinux)
+
+	generatedOther := suite.readFile("pkg/platform/platform_other.go")
+	expectedOther := `//go:build !linux && !wasip1
+
+package platform
+
+const name = "other"
+`
+
+	suite.Equal(expectedOther, generatedOther)
+
+	// the files that differ between the platforms are split
+	suite.NoFileExists(suite.filePath("pkg/platform/platform.go"))
+
+	generatedVariant1 := suite.readFile("pkg/platform/platform_variant1.go")
+	expectedVariant1 := `//go:build (linux && amd64) || (wasip1 && wasm) || (js && wasm)
+
+package platform
+
+const WordSize = 64
+
+func Name() string {
+	panic("stub")
+}
+`
+
+	suite.Equal(expectedVariant1, generatedVariant1)
+
+	generatedVariant2 := suite.readFile("pkg/platform/platform_variant2.go")
+	expectedVariant2 := `//go:build linux && 386
+
+package platform
+
+const WordSize = 32
+
+func Name() string {
+	panic("stub")
+}
+`
+
+	suite.Equal(expectedVariant2, generatedVariant2)
+	suite.FileExists(suite.filePath("pkg/platform/platform_wasip1.go"))
+	suite.FileExists(suite.filePath("pkg/platform/zz_gostubpkg_helpers.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsPlatformsPackageLayout() {
+	err := GenerateStubs(inputDir, []string{"./pkg/platform"}, suite.outputDir, Options{
+		Layout:    LayoutPackage,
+		Platforms: []string{"linux/amd64", "wasip1/wasm"},
+	})
+	suite.EqualError(err, `the "package" layout cannot be used with multiple platforms`)
+
+	err = GenerateStubs(inputDir, []string{"./pkg/platform"}, suite.outputDir, Options{
+		Platforms: []string{"linux"},
+	})
+	suite.EqualError(err, `invalid platform "linux", expected goos/goarch`)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsPlatformsAllPackages() {
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{
+		Platforms: []string{"linux/amd64", "wasip1/wasm"},
+	})
+	suite.NoError(err)
+
+	suite.FileExists(suite.filePath("pkg/platform/platform_wasip1.go"))
+	suite.NoFileExists(suite.filePath("pkg/types/mocks/MyInterface.go"))
+	suite.FileExists(suite.filePath("pkg/types/mocks/zz_gostubpkg_helpers.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsKeepDocs() {
+	err := GenerateStubs(inputDir, []string{"./pkg/docs"}, suite.outputDir, Options{
+		KeepDocs: true,
+		StubNote: "This function is a stub.",
+	})
+	suite.NoError(err)
+
+	generatedDocs := suite.readFile("pkg/docs/docs.go")
+	expectedDocs := `// Package docs is used to test the documentation of the stubs.
+package docs
+
+// MaxRetries is the number of retries.
+const MaxRetries = 3
+
+// Red stops the traffic.
+const Red = "red"
+
+const Green = "green"
+
+// DefaultName is used when the name is missing.
+//
+// Deprecated: use Config.Name instead.
+var DefaultName = "default"
+
+// Banner is printed at startup.
+var Banner string
+
+/*
+Client is a client.
+*/
+type Client interface {
+	Do() error
+}
+
+// Config configures the client.
+type Config struct{ Name string }
+
+// New creates a client.
+//
+// Deprecated: use NewClient instead.
+//
+// This function is a stub.
+func New() Client {
+	panic("stub")
+}
+
+// Close closes the client.
+//
+// This function is a stub.
+func (c *Config) Close() error {
+	panic("stub")
+}
+
+// This function is a stub.
+func Undocumented() {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedDocs, generatedDocs)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsDropDocs() {
+	err := GenerateStubs(inputDir, []string{"./pkg/docs"}, suite.outputDir, Options{})
+	suite.NoError(err)
+
+	generatedDocs := suite.readFile("pkg/docs/docs.go")
+	suite.NotContains(generatedDocs, "//")
+	suite.NotContains(generatedDocs, "/*")
+}
+
+func (suite *GenTestSuite) TestGenerateStubsKeepBodies() {
+	err := GenerateStubs(inputDir, []string{"./pkg/helpers"}, suite.outputDir, Options{
+		KeepBodies: []string{"helpers.IsNotFound", "helpers.ParseName", "helpers.(*Quantity).Value", "helpers.IsSystem"},
+	})
+	suite.NoError(err)
+
+	// the unexported helpers and the initializers used by the bodies are kept,
+	// the dot import of valid.go is qualified
+	generatedHelpers := suite.readFile("pkg/helpers/helpers.go")
+	expectedHelpers := `package helpers
+
+import (
+	"errors"
+	"regexp"
+	str "strings"
+)
+
+var ErrNotFound = errors.New("not found")
+
+var namePattern = regexp.MustCompile(` + "`^[a-z]+$`" + `)
+
+var unused *regexp.Regexp
+
+var systemPrefix, systemName, _ = str.Cut("kube-system", "-")
+
+type Quantity struct{ value int64 }
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func ParseName(s string) (string, error) {
+	// names are case insensitive
+	name := normalize(s)
+	if !valid(name) {
+		return "", ErrNotFound
+	}
+
+	return name, nil
+}
+
+func normalize(s string) string {
+	return str.ToLower(str.TrimSpace(s))
+}
+
+func (q *Quantity) Value() int64 {
+	return q.scaled(1)
+}
+
+func (q *Quantity) scaled(scale int64) int64 {
+	return q.value * scale
+}
+
+func PodName(pod interface{}) string {
+	panic("stub")
+}
+
+func IsSystem(namespace string) bool {
+	return namespace == systemPrefix+"-"+systemName
+}
+
+func valid(name string) bool {
+	return namePattern.MatchString(name) && !str.HasPrefix(name, "kube")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedHelpers, generatedHelpers)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsKeepBodiesRemovedPackage() {
+	err := GenerateStubs(inputDir, []string{"./pkg/helpers"}, suite.outputDir, Options{
+		KeepBodies: []string{"helpers.PodName"},
+	})
+
+	var stubErr *Error
+	suite.Require().ErrorAs(err, &stubErr)
+	suite.Equal("PodName", stubErr.Symbol)
+	suite.Contains(stubErr.Error(), "cannot keep the body")
+	suite.NoFileExists(suite.filePath("pkg/helpers/helpers.go"))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsStubModules() {
+	consumerDir := suite.copyConsumer()
+	stubsDir := filepath.Join(consumerDir, "stubs")
+
+	err := GenerateStubs(consumerDir, []string{"./..."}, stubsDir, Options{
+		StubModules: []string{module},
+	})
+	suite.NoError(err)
+
+	// only the packages imported by the consumer are stubbed
+	suite.FileExists(filepath.Join(stubsDir, module, "pkg/docs/docs.go"))
+	suite.FileExists(filepath.Join(stubsDir, module, "pkg/generics/generics.go"))
+	suite.NoFileExists(filepath.Join(stubsDir, module, "pkg/funcs/funcs.go"))
+
+	generatedGoMod, err := os.ReadFile(filepath.Join(stubsDir, module, "go.mod"))
+	suite.Require().NoError(err)
+	expectedGoMod := `module github.com/gostubpkg/testmod
+
+go 1.26.0
+
+toolchain go1.27.0
+`
+
+	suite.Equal(expectedGoMod, string(generatedGoMod))
+
+	consumerGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Contains(string(consumerGoMod), "replace github.com/gostubpkg/testmod => ./stubs/github.com/gostubpkg/testmod // gostubpkg: replaces")
+}
+
+func (suite *GenTestSuite) TestGenerateStubsStubModulesTwice() {
+	consumerDir := suite.copyConsumer()
+	stubsDir := filepath.Join(consumerDir, "stubs")
+
+	// the second run stubs the source module again, not the stubs of the first one
+	for range 2 {
+		err := GenerateStubs(consumerDir, []string{"./..."}, stubsDir, Options{
+			StubModules: []string{module},
+		})
+		suite.Require().NoError(err)
+	}
+
+	generatedDocs, err := os.ReadFile(filepath.Join(stubsDir, module, "pkg/docs/docs.go"))
+	suite.Require().NoError(err)
+	suite.Equal(1, strings.Count(string(generatedDocs), "type Embedme interface{}"))
+
+	consumerGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Contains(string(consumerGoMod), "// gostubpkg: replaces github.com/gostubpkg/testmod => /")
+
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = consumerDir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=readonly")
+	out, err := cmd.CombinedOutput()
+	suite.NoError(err, string(out))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsStubModulesAllowImports() {
+	consumerDir := suite.copyConsumer()
+	stubsDir := filepath.Join(consumerDir, "stubs")
+
+	err := GenerateStubs(consumerDir, []string{"./..."}, stubsDir, Options{
+		StubModules:  []string{module},
+		AllowImports: []string{"k8s.io/api/core/v1"},
+	})
+	suite.NoError(err)
+
+	// the allowed imports are required with the versions of the consumer module
+	generatedGoMod, err := os.ReadFile(filepath.Join(stubsDir, module, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Contains(string(generatedGoMod), "require (\n\tk8s.io/api v0.36.4\n)\n")
+	suite.Contains(string(generatedGoMod), "\tk8s.io/apimachinery v0.36.4 // indirect\n")
+
+	generatedGoSum, err := os.ReadFile(filepath.Join(stubsDir, module, "go.sum"))
+	suite.Require().NoError(err)
+	suite.Contains(string(generatedGoSum), "k8s.io/api v0.36.4 h1:")
+}
+
+func (suite *GenTestSuite) TestApplyAndRevertStubs() {
+	consumerDir := suite.copyConsumer()
+	stubsDir := filepath.Join(consumerDir, "stubs")
+
+	originalGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+
+	testmod, err := filepath.Abs(inputDir)
+	suite.Require().NoError(err)
+	expectedReplace := "replace github.com/gostubpkg/testmod => ./stubs/github.com/gostubpkg/testmod // gostubpkg: replaces github.com/gostubpkg/testmod => " + testmod + "\n"
+
+	err = GenerateStubs(consumerDir, []string{"./..."}, stubsDir, Options{
+		StubModules: []string{module},
+	})
+	suite.Require().NoError(err)
+
+	err = RevertStubs(consumerDir)
+	suite.Require().NoError(err)
+
+	revertedGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Equal(string(originalGoMod), string(revertedGoMod))
+
+	// applying the stubs twice keeps the original replace
+	for range 2 {
+		err = ApplyStubs(consumerDir, stubsDir)
+		suite.Require().NoError(err)
+
+		appliedGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+		suite.Require().NoError(err)
+		suite.Contains(string(appliedGoMod), expectedReplace)
+	}
+
+	err = RevertStubs(consumerDir)
+	suite.Require().NoError(err)
+
+	revertedGoMod, err = os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Equal(string(originalGoMod), string(revertedGoMod))
+}
+
+func (suite *GenTestSuite) TestApplyStubsSkipsOtherModules() {
+	consumerDir := suite.copyConsumer()
+	stubsDir := filepath.Join(consumerDir, "stubs")
+
+	err := GenerateStubs(consumerDir, []string{"./..."}, stubsDir, Options{
+		StubModules: []string{module},
+	})
+	suite.Require().NoError(err)
+
+	err = RevertStubs(consumerDir)
+	suite.Require().NoError(err)
+
+	// a module outside the directory of its module path is not a stub module
+	err = os.MkdirAll(filepath.Join(stubsDir, "tools"), 0o755)
+	suite.Require().NoError(err)
+	err = os.WriteFile(filepath.Join(stubsDir, "tools", "go.mod"), []byte("module example.com/tools\n"), 0o644)
+	suite.Require().NoError(err)
+
+	err = ApplyStubs(consumerDir, stubsDir)
+	suite.Require().NoError(err)
+
+	appliedGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Contains(string(appliedGoMod), "replace github.com/gostubpkg/testmod => ./stubs/github.com/gostubpkg/testmod")
+	suite.NotContains(string(appliedGoMod), "example.com/tools")
+}
+
+func (suite *GenTestSuite) TestGenerateStubsWorkFile() {
+	consumerDir := suite.copyConsumer()
+	stubsDir := filepath.Join(consumerDir, "stubs")
+	workFile := filepath.Join(consumerDir, "stubs.work")
+
+	originalGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+
+	err = GenerateStubs(consumerDir, []string{"./..."}, stubsDir, Options{
+		StubModules: []string{module},
+		WorkFile:    workFile,
+	})
+	suite.Require().NoError(err)
+
+	consumerGoMod, err := os.ReadFile(filepath.Join(consumerDir, "go.mod"))
+	suite.Require().NoError(err)
+	suite.Equal(string(originalGoMod), string(consumerGoMod))
+
+	generatedWork, err := os.ReadFile(workFile)
+	suite.Require().NoError(err)
+	expectedWork := `go 1.26.0
+
+use .
+
+replace github.com/gostubpkg/testmod => ./stubs/github.com/gostubpkg/testmod
+`
+
+	suite.Equal(expectedWork, string(generatedWork))
+
+	// the existing go.work is updated
+	err = os.WriteFile(workFile, []byte("go 1.25.0\n\nuse ./tools\n"), 0o644)
+	suite.Require().NoError(err)
+
+	err = ApplyStubsWork(consumerDir, stubsDir, workFile)
+	suite.Require().NoError(err)
+
+	updatedWork, err := os.ReadFile(workFile)
+	suite.Require().NoError(err)
+	expectedWork = `go 1.25.0
+
+use (
+	./tools
+	.
+)
+
+replace github.com/gostubpkg/testmod => ./stubs/github.com/gostubpkg/testmod
+`
+
+	suite.Equal(expectedWork, string(updatedWork))
+}
+
+func (suite *GenTestSuite) TestGenerateStubsStubModulesNotImported() {
+	consumerDir := suite.copyConsumer()
+
+	err := GenerateStubs(consumerDir, []string{"./..."}, suite.outputDir, Options{
+		StubModules: []string{"k8s.io/client-go"},
+	})
+	suite.EqualError(err, "module k8s.io/client-go is not imported by ./...")
+}
+
+func (suite *GenTestSuite) TestGenerateStubsAllowImports() {
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{AllowImports: []string{"k8s.io/api/core/v1"}})
+	suite.NoError(err)
+
+	generatedFuncs := suite.readFile("pkg/funcs/funcs.go")
+	expectedFuncs := `package funcs
+
+import (
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Bar[T1 any, T2 int](t1 []T1, t2 T2) T2 {
+	panic("stub")
+}
+
+func Baz(pod *corev1.Pod, writer io.Writer, str string) error {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedFuncs, generatedFuncs)
+
+	generatedTypes := suite.readFile("pkg/types/types.go")
+	expectedTypes := `package types
+
+import (
+	"io"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type MyEmbeddedStruct struct{}
+
+type MyInterface interface {
+	GetPodName(pod *corev1.Pod) string
+	getPodNamePrivate(pod *corev1.Pod) string
+}
+
+type MyStruct struct {
+	MyEmbeddedStruct
+	corev1.PodSpec
+	Name     string
+	Num      int
+	Pointer  *os.File
+	IOReader io.Reader
+	Pod      corev1.Pod
+}
+
+type MyTypeAlias string
+
+type MyTypeAlias2 MyStruct
+
+type MyTypeAlias3 corev1.Pod
+
+func (s *MyStruct) GetPodName(pod *corev1.Pod) string {
+	panic("stub")
+}
+
+type Embedme interface{}
+`
+
+	suite.Equal(expectedTypes, generatedTypes)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsFunctionBodies() {
+	err := GenerateStubs(inputDir, []string{"./..."}, suite.outputDir, Options{FunctionBodies: map[string]string{
+		"funcs.Bar":                    `panic("i don't like generics")`,
+		"types.(*MyStruct).GetPodName": `return "StubPodName"`,
+	}})
+	suite.NoError(err)
+
+	generatedFuncs := suite.readFile("pkg/funcs/funcs.go")
+	suite.Contains(generatedFuncs, `func Bar[T1 any, T2 int](t1 []T1, t2 T2) T2 {
+	panic("i don't like generics")
+`)
+
+	generatedTypes := suite.readFile("pkg/types/types.go")
+	suite.Contains(generatedTypes, `func (s *MyStruct) GetPodName(pod interface{}) string {
+	return "StubPodName"
+}
+`)
+}
+
+func (suite *GenTestSuite) TestGenerateStubsGenericFunctionBodies() {
+	err := GenerateStubs(inputDir, []string{"./pkg/generics"}, suite.outputDir, Options{FunctionBodies: map[string]string{
+		"generics.(*List[T]).Push":     `l.items = append(l.items, v)`,
+		"generics.(Pair[K, V]).String": `return "StubPair"`,
+		"generics.Push":                `l.Push(v)`,
+	}})
+	suite.NoError(err)
+
+	generatedGenerics := suite.readFile("pkg/generics/generics.go")
+	suite.Contains(generatedGenerics, `func (l *List[T]) Push(v T) {
+	l.items = append(l.items, v)
+}
+`)
+	suite.Contains(generatedGenerics, `func (p Pair[K, V]) String() string {
+	return "StubPair"
+}
+`)
+	suite.Contains(generatedGenerics, `func Push[T any](l *List[T], v T) {
+	l.Push(v)
+}
+`)
+}
+
+func (suite *GenTestSuite) filePath(filename string) string {
+	return filepath.Join(suite.outputDir, module, filename)
+}
+
+func (suite *GenTestSuite) fileExists(filename string) bool {
+	info, err := os.Stat(suite.filePath(filename))
+	if os.IsNotExist(err) {
+		return false
+	}
+	return !info.IsDir()
+}
+
+func (suite *GenTestSuite) readFile(filename string) string {
+	file, err := os.ReadFile(suite.filePath(filename))
+	suite.NoError(err)
+
+	return string(file)
+}
+
+// copyConsumer copies the consumer module in a temporary directory,
+// the module it consumes is replaced with the one of the test data.
+func (suite *GenTestSuite) copyConsumer() string {
+	dir := suite.T().TempDir()
+
+	for _, name := range []string{"go.mod", "go.sum", "main.go"} {
+		content, err := os.ReadFile(filepath.Join(consumerInputDir, name))
+		suite.Require().NoError(err)
+
+		if name == "go.mod" {
+			goMod, err := modfile.Parse(name, content, nil)
+			suite.Require().NoError(err)
+
+			testmod, err := filepath.Abs(inputDir)
+			suite.Require().NoError(err)
+			suite.Require().NoError(goMod.AddReplace(module, "", testmod, ""))
+
+			content, err = goMod.Format()
+			suite.Require().NoError(err)
+		}
+
+		suite.Require().NoError(os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+
+	return dir
 }
 
 func TestGenTestSuite(t *testing.T) {
@@ -0,0 +1,444 @@
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	goversion "go/version"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+	gomodule "golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+)
+
+// sourceModule is a module whose packages are stubbed by GenerateStubs.
+type sourceModule struct {
+	module *packages.Module
+	// pkgPaths are the import paths of the written stubs.
+	pkgPaths []string
+	// imports are the import paths referenced by the stubs.
+	imports []string
+}
+
+// writeGoMod writes the go.mod file in the root of the stub of a source module.
+// The go version, the toolchain and the godebug settings of the source module are kept.
+// The modules that provide the given imports of the stubs, and their dependencies,
+// are required with the versions used by the input module, and replaced the
+// same way. Their go.sum lines are copied too, so that the stub module builds offline.
+// The other source modules, like the ones of a go.work, are replaced with their stubs.
+func writeGoMod(inputDir string, outputDir string, mod *sourceModule, sources []*sourceModule, opts Options) error {
+	log.Debugf("generating go.mod file for module %s", mod.module.Path)
+	if mod.module.GoMod == "" {
+		return fmt.Errorf("missing go.mod file of module %s", mod.module.Path)
+	}
+
+	goModFile, err := os.ReadFile(mod.module.GoMod)
+	if err != nil {
+		return err
+	}
+
+	goMod, err := modfile.Parse(mod.module.GoMod, goModFile, nil)
+	if err != nil {
+		return err
+	}
+
+	// the versions of a main module are resolved by its own go.mod,
+	// the ones of a dependency, stubbed with opts.StubModules, by the consumer module
+	resolverDir := inputDir
+	if mod.module.Main {
+		resolverDir = mod.module.Dir
+	}
+
+	genGoModPath := filepath.Join(outputDir, mod.module.Path)
+	err = os.MkdirAll(genGoModPath, 0o755)
+	if err != nil {
+		return err
+	}
+
+	genGoMod := &modfile.File{}
+	err = genGoMod.AddModuleStmt(mod.module.Path)
+	if err != nil {
+		return err
+	}
+
+	version := ""
+	if goMod.Go != nil {
+		version = goMod.Go.Version
+	}
+	version, err = goVersion(mod.module.Dir, version, opts)
+	if err != nil {
+		return err
+	}
+
+	err = genGoMod.AddGoStmt(version)
+	if err != nil {
+		return err
+	}
+
+	// the toolchain is dropped with the pinned go version,
+	// it could be older than the version or be the reason of the pin
+	if goMod.Toolchain != nil && opts.GoVersion == "" {
+		err = genGoMod.AddToolchainStmt(goMod.Toolchain.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, godebug := range goMod.Godebug {
+		err = genGoMod.AddGodebug(godebug.Key, godebug.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the stubs of the other source modules import their own requirements,
+	// which must be required too
+	stubbed, imports := stubDependencies(mod, sources)
+	modules, err := requiredModules(inputDir, imports, mod.imports, stubbed, opts)
+	if err != nil {
+		return err
+	}
+
+	requires := []*modfile.Require{}
+	for _, req := range modules {
+		requires = append(requires, &modfile.Require{
+			Mod:      modVersion(req.module),
+			Indirect: !req.direct,
+		})
+	}
+	for _, src := range stubbed {
+		direct := slices.ContainsFunc(mod.imports, func(imported string) bool {
+			return slices.Contains(src.pkgPaths, imported)
+		})
+		requires = append(requires, &modfile.Require{
+			Mod:      gomodule.Version{Path: src.module.Path, Version: moduleVersion(src.module)},
+			Indirect: !direct,
+		})
+	}
+	sort.SliceStable(requires, func(i, j int) bool {
+		return requires[i].Mod.Path < requires[j].Mod.Path
+	})
+	genGoMod.SetRequireSeparateIndirect(requires)
+
+	for _, req := range modules {
+		replace := req.module.Replace
+		if replace == nil {
+			continue
+		}
+
+		// the local replacements are relative to the module that resolved them
+		path := replace.Path
+		if replace.Version == "" && !filepath.IsAbs(path) {
+			dir := replace.Dir
+			if dir == "" {
+				dir = filepath.Join(resolverDir, path)
+			}
+			path, err = relocatePath(dir, genGoModPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = genGoMod.AddReplace(req.module.Path, "", path, replace.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, src := range stubbed {
+		err = genGoMod.AddReplace(src.module.Path, "", localPath(genGoModPath, filepath.Join(outputDir, src.module.Path)), "")
+		if err != nil {
+			return err
+		}
+	}
+
+	content, err := genGoMod.Format()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(genGoModPath, "go.mod"), content, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return writeGoSum(resolverDir, genGoModPath, modules, opts)
+}
+
+// stubDependencies returns the other source modules whose stubs are imported,
+// transitively, by the stubs of the given module, sorted by path.
+// It returns the imports of the stubs of all these modules too, without the
+// packages of the source modules.
+func stubDependencies(mod *sourceModule, sources []*sourceModule) ([]*sourceModule, []string) {
+	moduleOf := func(pkgPath string) *sourceModule {
+		for _, src := range sources {
+			if slices.Contains(src.pkgPaths, pkgPath) {
+				return src
+			}
+		}
+		return nil
+	}
+
+	visited := map[string]bool{mod.module.Path: true}
+	stubbed := []*sourceModule{}
+	imports := []string{}
+	queue := []*sourceModule{mod}
+	for len(queue) > 0 {
+		src := queue[0]
+		queue = queue[1:]
+
+		for _, imported := range src.imports {
+			dep := moduleOf(imported)
+			if dep == nil {
+				if !slices.Contains(imports, imported) {
+					imports = append(imports, imported)
+				}
+				continue
+			}
+
+			if !visited[dep.module.Path] {
+				visited[dep.module.Path] = true
+				stubbed = append(stubbed, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	sort.Strings(imports)
+	sort.Slice(stubbed, func(i, j int) bool {
+		return stubbed[i].module.Path < stubbed[j].module.Path
+	})
+
+	return stubbed, imports
+}
+
+// goVersion returns the go version of a stub module: opts.GoVersion if it's set,
+// otherwise the given version of the source module. When the source module has no
+// go directive, the language version of the go command is used.
+func goVersion(inputDir string, version string, opts Options) (string, error) {
+	if opts.GoVersion != "" {
+		return opts.GoVersion, nil
+	}
+	if version != "" {
+		return version, nil
+	}
+
+	toolchain, err := goEnv(inputDir, "GOVERSION", opts)
+	if err != nil {
+		return "", err
+	}
+
+	// the development versions have no language version
+	lang := goversion.Lang(toolchain)
+	if lang == "" {
+		return "", fmt.Errorf("missing go directive, and no language version in %s", toolchain)
+	}
+	log.Debugf("missing go directive, using go %s", lang)
+
+	return strings.TrimPrefix(lang, "go"), nil
+}
+
+// goEnv returns the value of the given go environment variable in inputDir.
+func goEnv(inputDir string, name string, opts Options) (string, error) {
+	cmd := exec.Command("go", "env", name)
+	cmd.Dir = inputDir
+	cmd.Env = buildEnv(opts)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot get %s: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// requiredModule is a module required by the stub module.
+type requiredModule struct {
+	module *packages.Module
+	// direct is set if the stubs import a package of the module.
+	direct bool
+}
+
+// requiredModules returns the modules that provide the given imports and their
+// dependencies, sorted by path. The modules of the direct imports are direct requirements.
+// The standard library, the main modules and the stubbed source modules are skipped.
+func requiredModules(inputDir string, imports []string, direct []string, stubbed []*sourceModule, opts Options) ([]*requiredModule, error) {
+	if len(imports) == 0 {
+		return nil, nil
+	}
+
+	pkgs, err := load(inputDir, imports, opts, packages.NeedName|packages.NeedImports|packages.NeedDeps|packages.NeedModule)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dependencies of the standard library and of the source modules are not
+	// visited, the stubs of the source modules are imported instead of the packages.
+	modules := make(map[string]*requiredModule)
+	packages.Visit(pkgs, func(pkg *packages.Package) bool {
+		if pkg.Module == nil || pkg.Module.Main {
+			return false
+		}
+		if slices.ContainsFunc(stubbed, func(src *sourceModule) bool { return src.module.Path == pkg.Module.Path }) {
+			return false
+		}
+
+		req, ok := modules[pkg.Module.Path]
+		if !ok {
+			req = &requiredModule{module: pkg.Module}
+			modules[pkg.Module.Path] = req
+		}
+		req.direct = req.direct || slices.Contains(direct, pkg.PkgPath)
+
+		return true
+	}, nil)
+
+	result := []*requiredModule{}
+	for _, req := range modules {
+		result = append(result, req)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].module.Path < result[j].module.Path
+	})
+
+	return result, nil
+}
+
+// writeGoSum writes the go.sum lines of the given modules, and the go.mod lines of
+// the modules in their module graph, from the go.sum of the module that resolved them.
+func writeGoSum(moduleDir string, genGoModPath string, modules []*requiredModule, opts Options) error {
+	if len(modules) == 0 {
+		return nil
+	}
+
+	goSum, err := os.ReadFile(filepath.Join(moduleDir, "go.sum"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	graph, err := moduleGraph(moduleDir, opts)
+	if err != nil {
+		return err
+	}
+
+	// the go.mod files of the required modules and of their requirements, transitively,
+	// the graph refers to the replaced modules with their original path
+	required := make(map[string]bool)
+	visited := make(map[string]bool)
+	queue := []string{}
+	for _, req := range modules {
+		required[modVersion(req.module).String()] = true
+		queue = append(queue, modVersion(req.module).String())
+		if replace := req.module.Replace; replace != nil && replace.Version != "" {
+			required[modVersion(replace).String()] = true
+			visited[modVersion(replace).String()] = true
+		}
+	}
+	for len(queue) > 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		if visited[mod] {
+			continue
+		}
+		visited[mod] = true
+		queue = append(queue, graph[mod]...)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	scanner := bufio.NewScanner(bytes.NewReader(goSum))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		version, isGoMod := strings.CutSuffix(fields[1], "/go.mod")
+		if isGoMod && !visited[fields[0]+"@"+version] || !isGoMod && !required[fields[0]+"@"+version] {
+			continue
+		}
+
+		buf.WriteString(scanner.Text() + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	return os.WriteFile(filepath.Join(genGoModPath, "go.sum"), buf.Bytes(), 0o644)
+}
+
+// moduleGraph returns the requirements of the modules in the module graph of the
+// module in moduleDir, by module path and version like k8s.io/api@v0.36.4.
+func moduleGraph(moduleDir string, opts Options) (map[string][]string, error) {
+	cmd := exec.Command("go", "mod", "graph")
+	cmd.Dir = moduleDir
+	cmd.Env = buildEnv(opts)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the module graph: %w", err)
+	}
+
+	graph := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		mod, req, ok := strings.Cut(line, " ")
+		if ok {
+			graph[mod] = append(graph[mod], req)
+		}
+	}
+
+	return graph, nil
+}
+
+// relocatePath returns the given path relative to dir, as written in a replace directive.
+func relocatePath(path string, dir string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return localPath(absDir, absPath), nil
+}
+
+// modVersion returns the path and the version of the given module.
+func modVersion(mod *packages.Module) gomodule.Version {
+	return gomodule.Version{Path: mod.Path, Version: mod.Version}
+}
+
+// parseImports returns the import paths of a formatted stub file.
+func parseImports(file *stubFile) ([]string, error) {
+	astFile, err := parser.ParseFile(token.NewFileSet(), file.name, file.content, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := []string{}
+	for _, spec := range astFile.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, path)
+	}
+
+	return imports, nil
+}
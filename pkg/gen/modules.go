@@ -0,0 +1,219 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// generateModules generates the stubs of the packages of opts.StubModules
+// imported by the consumer module in the input directory,
+// and replaces the modules with their stubs in the consumer go.mod, or in opts.WorkFile.
+func generateModules(inputDir string, patterns []string, outputDir string, opts Options) error {
+	// the modules replaced with their stubs by a previous run are loaded
+	// from their sources, so the stubs are not stubbed again
+	modFile, err := revertedGoMod(inputDir)
+	if err != nil {
+		return err
+	}
+	if modFile != "" {
+		defer os.RemoveAll(filepath.Dir(modFile))
+
+		goFlags, err := goEnv(inputDir, "GOFLAGS", opts)
+		if err != nil {
+			return err
+		}
+		opts.Env = append(opts.Env, "GOFLAGS="+strings.TrimSpace(goFlags+" -modfile="+modFile))
+	}
+
+	modules, err := findStubModules(inputDir, patterns, opts)
+	if err != nil {
+		return err
+	}
+
+	stubbed := make(map[string]bool)
+	pkgPaths := []string{}
+	for _, mod := range modules {
+		for _, pkgPath := range mod.pkgPaths {
+			stubbed[pkgPath] = true
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
+	}
+
+	log.Debugf("generating stubs for modules %s", strings.Join(opts.StubModules, ", "))
+
+	// the packages are loaded from the consumer module,
+	// so they are built with the versions and the go.sum it uses
+	sources, err := generatePackages(inputDir, pkgPaths, outputDir, opts, stubbed)
+	if err != nil && (!opts.KeepGoing || !errors.As(err, new(Errors))) {
+		return err
+	}
+	pkgErr := err
+
+	stubs := make(map[string]string)
+	for _, src := range sources {
+		err = writeGoMod(inputDir, outputDir, src, sources, opts)
+		if err != nil {
+			return err
+		}
+
+		stubs[src.module.Path] = filepath.Join(outputDir, src.module.Path)
+	}
+
+	// the consumer go.mod is left untouched when a go.work is used
+	if opts.WorkFile != "" {
+		err = replaceModulesWork(opts.WorkFile, inputDir, stubs)
+	} else {
+		err = replaceModules(filepath.Join(inputDir, "go.mod"), stubs)
+	}
+	if err != nil {
+		return err
+	}
+
+	return pkgErr
+}
+
+// revertedGoMod writes a copy of the consumer go.mod, and of its go.sum,
+// without the replace directives added by gostubpkg, in a temporary directory.
+// It returns the path of the copy, or an empty string if there are no such directives.
+func revertedGoMod(inputDir string) (string, error) {
+	goModPath := filepath.Join(inputDir, "go.mod")
+	content, err := os.ReadFile(goModPath)
+	if err != nil {
+		return "", err
+	}
+
+	goMod, err := modfile.Parse(goModPath, content, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.ContainsFunc(goMod.Replace, func(r *modfile.Replace) bool {
+		if r.Syntax == nil {
+			return false
+		}
+		_, ok := markedReplaces(r.Syntax)
+		return ok
+	}) {
+		return "", nil
+	}
+
+	err = revertReplaces(goMod)
+	if err != nil {
+		return "", err
+	}
+
+	goMod.Cleanup()
+	content, err = goMod.Format()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "gostubpkg")
+	if err != nil {
+		return "", err
+	}
+
+	// the go.sum of the -modfile is the one next to it
+	goSum, err := os.ReadFile(filepath.Join(inputDir, "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.Join(err, os.RemoveAll(dir))
+	}
+
+	modFile := filepath.Join(dir, "go.mod")
+	log.Debugf("loading the packages with %s, without the stubs of a previous run", modFile)
+	err = errors.Join(os.WriteFile(modFile, content, 0o644), os.WriteFile(filepath.Join(dir, "go.sum"), goSum, 0o644))
+	if err != nil {
+		return "", errors.Join(err, os.RemoveAll(dir))
+	}
+
+	return modFile, nil
+}
+
+// findStubModules finds the packages of opts.StubModules transitively imported
+// by the packages matching the patterns, on all the platforms.
+func findStubModules(inputDir string, patterns []string, opts Options) ([]*sourceModule, error) {
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{""}
+	}
+
+	modules := make(map[string]*sourceModule)
+	for _, platform := range platforms {
+		pkgs, err := load(inputDir, patterns, platformOptions(opts, platform),
+			packages.NeedName|packages.NeedImports|packages.NeedDeps|packages.NeedModule)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(pkgs) == 0 {
+			return nil, fmt.Errorf("no packages found in %s", strings.Join(patterns, ", "))
+		}
+
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			if !isStubModule(pkg, opts.StubModules) {
+				return
+			}
+
+			mod, ok := modules[pkg.Module.Path]
+			if !ok {
+				mod = &sourceModule{module: pkg.Module}
+				modules[pkg.Module.Path] = mod
+			}
+			if !slices.Contains(mod.pkgPaths, pkg.PkgPath) {
+				mod.pkgPaths = append(mod.pkgPaths, pkg.PkgPath)
+			}
+		})
+	}
+
+	result := []*sourceModule{}
+	for _, path := range opts.StubModules {
+		mod, ok := modules[path]
+		if !ok {
+			return nil, fmt.Errorf("module %s is not imported by %s", path, strings.Join(patterns, ", "))
+		}
+		sort.Strings(mod.pkgPaths)
+		result = append(result, mod)
+	}
+
+	return result, nil
+}
+
+// isStubModule checks if the given package belongs to one of the modules to stub.
+func isStubModule(pkg *packages.Package, modules []string) bool {
+	return pkg.Module != nil && slices.Contains(modules, pkg.Module.Path)
+}
+
+// moduleVersion returns the version of the given module,
+// the local modules have no version.
+func moduleVersion(mod *packages.Module) string {
+	if mod.Version == "" {
+		return "v0.0.0"
+	}
+
+	return mod.Version
+}
+
+// localPath returns the path of target relative to dir, as written in a replace directive.
+// The absolute path is used if the relative one cannot be computed.
+func localPath(dir string, target string) string {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return target
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+
+	return rel
+}
@@ -0,0 +1,144 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// platformFiles are the stub files of a package rendered for a platform.
+type platformFiles struct {
+	// platform is the goos/goarch pair, empty for the environment platform.
+	platform string
+	files    []*stubFile
+}
+
+// splitPlatform splits a goos/goarch pair.
+func splitPlatform(platform string) (string, string, error) {
+	goos, goarch, ok := strings.Cut(platform, "/")
+	if !ok || goos == "" || goarch == "" {
+		return "", "", fmt.Errorf("invalid platform %q, expected goos/goarch", platform)
+	}
+
+	return goos, goarch, nil
+}
+
+// platformOptions returns the options used to load the packages for the given platform.
+func platformOptions(opts Options, platform string) Options {
+	if platform == "" {
+		return opts
+	}
+
+	// the platform has already been validated
+	opts.GOOS, opts.GOARCH, _ = splitPlatform(platform)
+	return opts
+}
+
+// fileConstraint returns the //go:build constraint of the given file, nil if it has none.
+func fileConstraint(astFile *ast.File) constraint.Expr {
+	for _, group := range astFile.Comments {
+		if group.Pos() >= astFile.Package {
+			break
+		}
+
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				// the file has already been selected by the build system,
+				// the constraint cannot be invalid
+				continue
+			}
+			return expr
+		}
+	}
+
+	return nil
+}
+
+// mergePlatforms merges the stub files of a package rendered for different platforms.
+// The files with the same name and the same content on all the platforms they
+// are built for are written once, with the constraint of the source file.
+// Otherwise every variant of the file is written with a constraint that selects
+// the platforms it was rendered for.
+func mergePlatforms(stubs []platformFiles) []*stubFile {
+	type variant struct {
+		file      *stubFile
+		platforms []string
+	}
+
+	names := []string{}
+	variants := make(map[string][]*variant)
+	for _, stub := range stubs {
+		for _, file := range stub.files {
+			if _, ok := variants[file.name]; !ok {
+				names = append(names, file.name)
+			}
+
+			found := false
+			for _, v := range variants[file.name] {
+				if bytes.Equal(v.file.content, file.content) {
+					v.platforms = append(v.platforms, stub.platform)
+					found = true
+					break
+				}
+			}
+			if !found {
+				variants[file.name] = append(variants[file.name], &variant{file: file, platforms: []string{stub.platform}})
+			}
+		}
+	}
+	sort.Strings(names)
+
+	files := []*stubFile{}
+	for _, name := range names {
+		if len(variants[name]) == 1 {
+			files = append(files, variants[name][0].file)
+			continue
+		}
+
+		// The variants cannot keep the name of the source file,
+		// the platforms of the file name suffix are part of the new constraint.
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		for i, v := range variants[name] {
+			expr := platformsConstraint(v.platforms)
+			if v.file.constraint != nil {
+				expr = &constraint.AndExpr{X: v.file.constraint, Y: expr}
+			}
+
+			v.file.name = stem + "_variant" + strconv.Itoa(i+1) + ".go"
+			v.file.constraint = expr
+			files = append(files, v.file)
+		}
+	}
+
+	return files
+}
+
+// platformsConstraint returns the build constraint that selects the given platforms.
+func platformsConstraint(platforms []string) constraint.Expr {
+	var expr constraint.Expr
+	for _, platform := range platforms {
+		goos, goarch, _ := splitPlatform(platform)
+		and := &constraint.AndExpr{
+			X: &constraint.TagExpr{Tag: goos},
+			Y: &constraint.TagExpr{Tag: goarch},
+		}
+
+		if expr == nil {
+			expr = and
+		} else {
+			expr = &constraint.OrExpr{X: expr, Y: and}
+		}
+	}
+
+	return expr
+}
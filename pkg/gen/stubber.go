@@ -0,0 +1,288 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// stubber renders the declarations of a single package.
+// Every type is resolved through the type checker, so the packages referenced
+// by the stub are classified by their import path and not by the identifier
+// used in the original source.
+type stubber struct {
+	pkg  *packages.Package
+	info *types.Info
+	// allowed reports whether the types of the package with the given import
+	// path can be kept in the stub.
+	allowed func(pkgPath string) bool
+	// names maps the import path of a package to the name used to refer to it
+	// in the stub.
+	names map[string]string
+	// taken maps the names used in the package scope of the stub to the import
+	// path of the package they refer to, it's empty for the declarations.
+	taken map[string]string
+	// used collects the import paths of the packages referenced by the stub
+	// file being rendered.
+	used map[string]struct{}
+	// errs collects the declarations that cannot be stubbed.
+	errs Errors
+	// keepDocs copies the doc comments in the stub.
+	keepDocs bool
+	// stubNote is added to the doc comments of the stubbed functions.
+	stubNote string
+	// kept collects the declarations whose original source is kept.
+	kept keptBodies
+	// sources caches the content of the source files by name.
+	sources map[string][]byte
+}
+
+func newStubber(pkg *packages.Package, allowed func(pkgPath string) bool) *stubber {
+	s := &stubber{
+		pkg:     pkg,
+		info:    pkg.TypesInfo,
+		allowed: allowed,
+		names:   make(map[string]string),
+		taken:   make(map[string]string),
+		used:    make(map[string]struct{}),
+		sources: make(map[string][]byte),
+	}
+
+	for _, name := range pkg.Types.Scope().Names() {
+		s.taken[name] = ""
+	}
+
+	// Reuse the names of the original imports, the first file wins.
+	// Dot imports are referred to by their package name, blank imports are not used.
+	// The files of a package can import different packages with the same name,
+	// the later ones are renamed since the stubs of the files can be merged.
+	for _, astFile := range pkg.Syntax {
+		if ast.IsGenerated(astFile) {
+			continue
+		}
+
+		for _, spec := range astFile.Imports {
+			pkgName := s.info.PkgNameOf(spec)
+			if pkgName == nil {
+				continue
+			}
+
+			imported := pkgName.Imported()
+			if _, ok := s.names[imported.Path()]; ok {
+				continue
+			}
+
+			name := pkgName.Name()
+			if name == "_" {
+				continue
+			}
+			if name == "." {
+				name = imported.Name()
+			}
+			s.names[imported.Path()] = s.uniqueName(name, imported.Path())
+		}
+	}
+
+	return s
+}
+
+// uniqueName returns a name for the package with the given import path that
+// doesn't conflict with the other names of the package scope.
+// The name is prefixed with the parent element of the import path, like metav1
+// for k8s.io/apimachinery/pkg/apis/meta/v1, then numbered.
+func (s *stubber) uniqueName(name string, pkgPath string) string {
+	available := func(candidate string) bool {
+		owner, ok := s.taken[candidate]
+		return !ok || owner == pkgPath
+	}
+
+	candidates := []string{name}
+	elems := strings.Split(pkgPath, "/")
+	if len(elems) > 1 {
+		if prefix := identifier(elems[len(elems)-2]); prefix != "" {
+			candidates = append(candidates, prefix+name)
+		}
+	}
+
+	unique := ""
+	for _, candidate := range candidates {
+		if available(candidate) {
+			unique = candidate
+			break
+		}
+	}
+	for i := 2; unique == ""; i++ {
+		if candidate := name + strconv.Itoa(i); available(candidate) {
+			unique = candidate
+		}
+	}
+	s.taken[unique] = pkgPath
+
+	return unique
+}
+
+// identifier returns the letters and the digits of the given path element, in lower case.
+func identifier(elem string) string {
+	id := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, elem)
+
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		return ""
+	}
+
+	return id
+}
+
+// qualifier returns the name used to refer to the given package in the stub
+// and records the package as imported.
+// It returns an empty string for the stubbed package itself.
+func (s *stubber) qualifier(pkg *types.Package) string {
+	if pkg == s.pkg.Types {
+		return ""
+	}
+
+	name, ok := s.names[pkg.Path()]
+	if !ok {
+		name = s.uniqueName(pkg.Name(), pkg.Path())
+		s.names[pkg.Path()] = name
+	}
+	s.used[pkg.Path()] = struct{}{}
+
+	return name
+}
+
+// errorf records an error for the declaration of symbol at the given position.
+func (s *stubber) errorf(pos token.Pos, symbol string, format string, args ...any) {
+	position := s.pkg.Fset.Position(pos)
+	s.errs = append(s.errs, &Error{
+		Package: s.pkg.PkgPath,
+		File:    position.Filename,
+		Line:    position.Line,
+		Symbol:  symbol,
+		Err:     fmt.Errorf(format, args...),
+	})
+}
+
+// isErased checks if the given type, or the type it points to, is declared in
+// a package that is removed from the stub.
+func (s *stubber) isErased(typ types.Type) bool {
+	var obj *types.TypeName
+	switch t := typ.(type) {
+	case *types.Named:
+		obj = t.Obj()
+	case *types.Alias:
+		obj = t.Obj()
+	case *types.Pointer:
+		return s.isErased(t.Elem())
+	default:
+		return false
+	}
+
+	if obj.Pkg() == nil || obj.Pkg() == s.pkg.Types {
+		return false
+	}
+
+	return !s.allowed(obj.Pkg().Path())
+}
+
+// isErasedEmbedded checks if the given embedded type is removed from the stub,
+// even through the aliases of the stubbed package, like type Alias = ext.T,
+// which is stubbed as an alias of interface{} and cannot be embedded by pointer.
+func (s *stubber) isErasedEmbedded(typ types.Type) bool {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	for {
+		alias, ok := typ.(*types.Alias)
+		if !ok || alias.Obj().Pkg() != s.pkg.Types {
+			break
+		}
+		typ = alias.Rhs()
+	}
+
+	return s.isErased(typ)
+}
+
+// isErasedConstType checks if the given type of a constant is removed from the stub,
+// or if it's declared in the stubbed package with a type that is removed, like
+// type X ext.Phase, which is stubbed as type X interface{}.
+func (s *stubber) isErasedConstType(typ types.Type) bool {
+	if s.isErased(typ) {
+		return true
+	}
+
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() != s.pkg.Types {
+		return false
+	}
+
+	declared := s.declaredType(named.Obj())
+	return declared != nil && s.isErasedConstType(declared)
+}
+
+// declaredType returns the type used in the declaration of the given type of the
+// stubbed package, like ext.Phase for type X ext.Phase.
+func (s *stubber) declaredType(obj *types.TypeName) types.Type {
+	for _, astFile := range s.pkg.Syntax {
+		for _, xdecl := range astFile.Decls {
+			decl, ok := xdecl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if s.info.Defs[ts.Name] == obj {
+					return s.info.TypeOf(ts.Type)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeImports writes the import declaration of the given packages.
+func (s *stubber) writeImports(buf *bytes.Buffer, used map[string]struct{}) error {
+	if len(used) == 0 {
+		return nil
+	}
+
+	paths := []string{}
+	for path := range used {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	specs := []string{}
+	for _, path := range paths {
+		spec := strconv.Quote(path)
+
+		// Always write the name when it cannot be guessed from the import
+		// path, otherwise goimports would consider the import unused.
+		if name := s.names[path]; name != path[strings.LastIndex(path, "/")+1:] {
+			spec = name + " " + spec
+		}
+		specs = append(specs, spec)
+	}
+
+	i := "import " + specs[0] + "\n\n"
+	if len(specs) > 1 {
+		i = "import (\n" + strings.Join(specs, "\n") + "\n)\n\n"
+	}
+
+	_, err := buf.WriteString(i)
+	return err
+}
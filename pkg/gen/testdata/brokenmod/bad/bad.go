@@ -0,0 +1,5 @@
+package bad
+
+func Broken() Missing {
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/gostubpkg/brokenmod
+
+go 1.26.0
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gostubpkg/testmod/pkg/aliases"
+	"github.com/gostubpkg/testmod/pkg/docs"
+	"github.com/gostubpkg/testmod/pkg/generics"
+)
+
+func main() {
+	var pods aliases.PodList
+	fmt.Println(docs.MaxRetries, generics.Map[int, int](nil, nil), len(pods))
+}
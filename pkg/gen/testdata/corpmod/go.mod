@@ -0,0 +1,7 @@
+module mycorp/app
+
+go 1.26.0
+
+require mycorp/lib v0.0.0
+
+replace mycorp/lib => ./lib
@@ -0,0 +1,3 @@
+module mycorp/lib
+
+go 1.26.0
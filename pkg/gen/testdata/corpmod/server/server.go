@@ -0,0 +1,18 @@
+package server
+
+import (
+	"net/http"
+
+	"mycorp/app/models"
+	"mycorp/lib"
+)
+
+type Server struct {
+	Client  *lib.Client
+	Handler http.Handler
+	Users   []models.User
+}
+
+func (s *Server) User(name string) (*models.User, error) {
+	return nil, nil
+}
@@ -0,0 +1,6 @@
+module github.com/gostubpkg/legacymod
+
+godebug (
+	panicnil=1
+	http2client=0
+)
@@ -0,0 +1,5 @@
+package legacy
+
+func Hello() string {
+	return "hello"
+}
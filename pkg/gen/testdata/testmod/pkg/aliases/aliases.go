@@ -0,0 +1,37 @@
+package aliases
+
+import (
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type Handler = http.Handler
+
+type Pod = corev1.Pod
+
+type PodList = []*corev1.Pod
+
+type PodRef struct {
+	*Pod
+	Phase
+}
+
+type Phase = corev1.PodPhase
+
+const Pending Phase = "Pending"
+
+type Set[T comparable] = map[T]struct{}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type StringPair[V any] = Pair[string, V]
+
+type Names = Set[string]
+
+func Serve(h Handler, pods PodList) Names {
+	return nil
+}
@@ -0,0 +1,23 @@
+package arrays
+
+import (
+	"crypto/sha256"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const N = 4
+
+var names = [...]string{"a", "b", "c"}
+
+type Digest [sha256.Size]byte
+
+type Block struct {
+	Words [2 * N]uint32
+	Names [len(names)]string
+	UIDs  [N]types.UID
+}
+
+func Sum(data []byte) [sha256.Size]byte {
+	return sha256.Sum256(data)
+}
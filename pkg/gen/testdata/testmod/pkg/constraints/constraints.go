@@ -0,0 +1,61 @@
+package constraints
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+type Integer interface {
+	~int
+}
+
+type Stringish interface {
+	~string
+	fmt.Stringer
+}
+
+type Phase interface {
+	corev1.PodPhase | string
+}
+
+type OnlyPhase interface {
+	comparable
+	corev1.PodPhase
+}
+
+type PodSpecs interface {
+	*corev1.PodSpec | corev1.PodSpec
+}
+
+func Sum[T Number](values ...T) T {
+	var sum T
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func Len[T ~string | ~[]byte](v T) int {
+	return len(v)
+}
+
+func Name[T *corev1.Pod | *corev1.Node](obj T) string {
+	return ""
+}
+
+type Ptr[T *int,] struct {
+	v T
+}
+
+type Ref[T *int | *string,] struct {
+	v T
+}
+
+func Deref[T *int](p T) int {
+	return *p
+}
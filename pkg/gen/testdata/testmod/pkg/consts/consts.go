@@ -0,0 +1,53 @@
+package consts
+
+import (
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type Phase string
+
+const (
+	Pending Phase = "Pending"
+	Running Phase = "Running"
+)
+
+type Level int
+
+const (
+	_ Level = iota
+	Debug
+	Info
+	_
+	Error
+)
+
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+)
+
+const Timeout = 2 * time.Second
+
+const Min, Max = 0, 10
+
+const (
+	Pi     = math.Pi
+	Half   = 1.0 / 2
+	Third  = 1.0 / 3
+	Scale  = 2.0
+	Letter = 'a'
+	Imag   = 1 + 2i
+	Tiny   = -1.0 / 1024
+	Yes    = !false
+)
+
+const Succeeded = corev1.PodSucceeded
+
+type ExtPhase corev1.PodPhase
+
+const Failed ExtPhase = "Failed"
+
+const Ratio float32 = 0.1
@@ -0,0 +1,53 @@
+// Package docs is used to test the documentation of the stubs.
+package docs
+
+import _ "embed"
+
+// MaxRetries is the number of retries.
+const MaxRetries = 3
+
+// Colors of the traffic light.
+const (
+	// Red stops the traffic.
+	Red   = "red"
+	Green = "green"
+)
+
+// DefaultName is used when the name is missing.
+//
+// Deprecated: use Config.Name instead.
+var DefaultName = "default"
+
+// Banner is printed at startup.
+//
+//go:embed banner.txt
+var Banner string
+
+// Config configures the client.
+type Config struct {
+	Name string
+}
+
+/*
+Client is a client.
+*/
+type Client interface {
+	Do() error
+}
+
+// New creates a client.
+//
+// Deprecated: use NewClient instead.
+func New() Client {
+	return nil
+}
+
+// Close closes the client.
+//
+//go:generate echo close
+//go:noinline
+func (c *Config) Close() error {
+	return nil
+}
+
+func Undocumented() {}
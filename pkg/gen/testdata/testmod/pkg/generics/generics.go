@@ -0,0 +1,68 @@
+package generics
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type List[T any] struct {
+	items []T
+	Head  *List[T]
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Getter[T any] interface {
+	Get() T
+}
+
+type Box[T any] struct {
+	value atomic.Pointer[T]
+}
+
+type Strings List[string]
+
+type Pods List[corev1.Pod]
+
+type PodGetter Getter[*corev1.Pod]
+
+type Named[T fmt.Stringer] struct {
+	Value T
+}
+
+type Phased[T ~string] struct {
+	Value T
+}
+
+type NamedPod Named[*corev1.Pod]
+
+type PodPhase Phased[corev1.PodPhase]
+
+func Map[K, V any](in []K, fn func(K) V) []V {
+	out := make([]V, 0, len(in))
+	for _, k := range in {
+		out = append(out, fn(k))
+	}
+	return out
+}
+
+func First[T any, L List[T]](l L) Pair[int, T] {
+	return Pair[int, T]{}
+}
+
+func (l *List[T]) Push(v T) {
+	l.items = append(l.items, v)
+}
+
+func (p Pair[K, V]) String() string {
+	return "pair"
+}
+
+func Push[T any](l *List[T], v T) {
+	l.Push(v)
+}
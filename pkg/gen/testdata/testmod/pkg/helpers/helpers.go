@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"errors"
+	"regexp"
+	str "strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var ErrNotFound = errors.New("not found")
+
+var namePattern = regexp.MustCompile(`^[a-z]+$`)
+
+var unused = regexp.MustCompile(`.*`)
+
+var systemPrefix, systemName, _ = str.Cut("kube-system", "-")
+
+// IsNotFound checks if the error is a not found error.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// ParseName parses a name.
+func ParseName(s string) (string, error) {
+	// names are case insensitive
+	name := normalize(s)
+	if !valid(name) {
+		return "", ErrNotFound
+	}
+
+	return name, nil
+}
+
+func normalize(s string) string {
+	return str.ToLower(str.TrimSpace(s))
+}
+
+type Quantity struct {
+	value int64
+}
+
+func (q *Quantity) Value() int64 {
+	return q.scaled(1)
+}
+
+func (q *Quantity) scaled(scale int64) int64 {
+	return q.value * scale
+}
+
+func PodName(pod *corev1.Pod) string {
+	return pod.Name
+}
+
+// IsSystem checks if the namespace is the system one.
+func IsSystem(namespace string) bool {
+	return namespace == systemPrefix+"-"+systemName
+}
@@ -0,0 +1,7 @@
+package helpers
+
+import . "strings"
+
+func valid(name string) bool {
+	return namePattern.MatchString(name) && !HasPrefix(name, "kube")
+}
@@ -0,0 +1,28 @@
+package ifaces
+
+import (
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type ReadCloser interface {
+	io.Reader
+	Close() error
+}
+
+type named interface {
+	Name() string
+}
+
+type Named interface {
+	named
+	fmt.Stringer
+}
+
+type Object interface {
+	runtime.Object
+	DeepCopyObject() runtime.Object
+	GetName() string
+}
@@ -0,0 +1,20 @@
+package imports
+
+import (
+	"bytes"
+	stdio "io"
+	. "strings"
+
+	mytypes "github.com/gostubpkg/testmod/pkg/types"
+)
+
+type Wrapper struct {
+	Reader  stdio.Reader
+	Builder *Builder
+	Buffer  bytes.Buffer
+	Struct  *mytypes.MyStruct
+}
+
+func Copy(dst stdio.Writer, src *Reader) (int64, error) {
+	return stdio.Copy(dst, src)
+}
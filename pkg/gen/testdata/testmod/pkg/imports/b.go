@@ -0,0 +1,9 @@
+package imports
+
+import (
+	io "k8s.io/api/core/v1"
+)
+
+func PodName(pod *io.Pod) string {
+	return pod.Name
+}
@@ -0,0 +1,37 @@
+package inline
+
+import (
+	"context"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Config struct {
+	Options struct {
+		Timeout int `json:"timeout"`
+		Retries int
+		Pod     corev1.Pod `json:"pod"`
+		corev1.PodSpec
+	} `json:"options"`
+	Hooks    []struct{ Name string }
+	Callback func(ctx context.Context, pod *corev1.Pod) error
+}
+
+func Write(w interface {
+	Write([]byte) (int, error)
+	io.Closer
+}, data []byte) error {
+	return nil
+}
+
+func Handle(obj interface {
+	metav1.Object
+	GetName() string
+}) {
+}
+
+func Point() struct{ X, Y int } {
+	return struct{ X, Y int }{}
+}
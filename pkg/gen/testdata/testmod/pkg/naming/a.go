@@ -0,0 +1,11 @@
+package naming
+
+import (
+	"github.com/gostubpkg/testmod/pkg/naming/yaml.v3"
+	v1 "k8s.io/api/core/v1"
+)
+
+type A struct {
+	Pod  v1.Pod
+	Node yaml.Node
+}
@@ -0,0 +1,15 @@
+package naming
+
+import (
+	"github.com/gostubpkg/testmod/pkg/naming/other/v1"
+	"github.com/gostubpkg/testmod/pkg/naming/versioned/v2"
+)
+
+type B struct {
+	Item    v1.Item
+	Version versioned.Version
+}
+
+func NewB(item v1.Item) *B {
+	return &B{Item: item}
+}
@@ -0,0 +1,5 @@
+package versioned
+
+type Version struct {
+	Major int
+}
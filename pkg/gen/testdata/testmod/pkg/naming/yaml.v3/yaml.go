@@ -0,0 +1,5 @@
+package yaml
+
+type Node struct {
+	Value string
+}
@@ -0,0 +1,7 @@
+//go:build integration
+
+package platform
+
+func Fixture() string {
+	return "fixture"
+}
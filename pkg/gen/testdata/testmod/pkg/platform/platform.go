@@ -0,0 +1,8 @@
+package platform
+
+// WordSize is the size of uint in bits.
+const WordSize = 32 << (^uint(0) >> 63)
+
+func Name() string {
+	return name
+}
@@ -0,0 +1,7 @@
+package platform
+
+const name = "linux"
+
+func Epoll() int {
+	return 0
+}
@@ -0,0 +1,5 @@
+//go:build !linux && !wasip1
+
+package platform
+
+const name = "other"
@@ -0,0 +1,7 @@
+package platform
+
+const name = "wasip1"
+
+func Poll() int {
+	return 0
+}
@@ -0,0 +1,11 @@
+package receivers
+
+type T struct{}
+
+func (*T) Unnamed() {}
+
+func (_ T) Blank() string {
+	return ""
+}
+
+func (t *T) Named() {}
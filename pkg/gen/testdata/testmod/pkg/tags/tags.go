@@ -0,0 +1,17 @@
+package tags
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Config struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Name   string            `json:"name" yaml:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Pod    corev1.Pod        `json:"pod" protobuf:"bytes,1,opt,name=pod"`
+	Raw    string            "raw:\"`\""
+	plain  int
+}
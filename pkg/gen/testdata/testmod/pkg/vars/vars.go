@@ -0,0 +1,36 @@
+package vars
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type Client struct {
+	Name string
+}
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = fmt.Errorf("invalid: %w", ErrNotFound)
+	ErrExternal = fmt.Errorf("external: %w", os.ErrNotExist)
+	ErrLimit    = fmt.Errorf("over %d%% of %s: %w", 90, "the quota", ErrInvalid)
+	ErrRemoved  = fmt.Errorf("pod %v is %w", corev1.SchemeGroupVersion, ErrNotFound)
+)
+
+var DefaultClient = &Client{Name: "default"}
+
+var Clients = map[string]*Client{}
+
+var Transport http.RoundTripper = http.DefaultTransport
+
+var Pod = corev1.Pod{}
+
+var Timeout int64 = 30
+
+var Host, Port = "localhost", 8080
+
+var stdout = os.Stdout
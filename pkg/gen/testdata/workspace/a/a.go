@@ -0,0 +1,9 @@
+package a
+
+type Pod struct {
+	Name string
+}
+
+func NewPod(name string) *Pod {
+	return &Pod{Name: name}
+}
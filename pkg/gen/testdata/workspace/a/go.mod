@@ -0,0 +1,3 @@
+module github.com/gostubpkg/workspace/a
+
+go 1.26.0
@@ -0,0 +1,11 @@
+package b
+
+import "github.com/gostubpkg/workspace/a"
+
+type Controller struct {
+	Pods []*a.Pod
+}
+
+func (c *Controller) Add(pod *a.Pod) {
+	c.Pods = append(c.Pods, pod)
+}
@@ -0,0 +1,3 @@
+module github.com/gostubpkg/workspace/b
+
+go 1.26.0